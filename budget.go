@@ -0,0 +1,153 @@
+package xian
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// IndexDegraded is an index saved with indexes degraded by BudgetPolicy.
+const IndexDegraded = "__Degraded__"
+
+// BudgetStrategy is a strategy to reduce indexes exceeding MaxIndexesSize.
+//
+// There is no strategy to hash tokens into fewer indexes:
+// Filters can't know whether an entity was degraded, so hashed filters would miss entities saved with plain tokens
+// and plain filters would miss hashed ones. Query degraded entities with IndexDegraded and verify them instead.
+type BudgetStrategy int
+
+const (
+	// DropCompositeIndexes drops all the composite indexes.
+	DropCompositeIndexes BudgetStrategy = iota + 1
+	// DropLongestTokens drops the fewest tokens of labels in BudgetPolicy.Priorities to fit indexes,
+	// including their composite indexes, from the lowest priority label and the longest token,
+	// e.g. the longest prefixes and suffixes are dropped first.
+	DropLongestTokens
+	// DropLabels drops all the tokens of the fewest labels in BudgetPolicy.Priorities to fit indexes
+	// from the lowest priority label.
+	DropLabels
+)
+
+// BudgetPolicy describes how to degrade indexes exceeding MaxIndexesSize instead of failing.
+type BudgetPolicy struct {
+	// Strategies are applied in order until indexes fit in MaxIndexesSize.
+	Strategies []BudgetStrategy `json:"strategies" yaml:"strategies"`
+	// Priorities is priorities of labels which can be degraded.
+	// Labels with lower priorities are degraded first. Labels not in Priorities are never degraded.
+	Priorities map[string]int `json:"priorities,omitempty" yaml:"priorities,omitempty"`
+}
+
+// BuildReport describes indexes degraded by BudgetPolicy.
+type BuildReport struct {
+	// CompositeDropped reports whether composite indexes were dropped.
+	CompositeDropped bool
+	// DroppedTokens is the number of dropped tokens for each label.
+	DroppedTokens map[string]int
+
+	compositeIdxLabels []string
+}
+
+// Degraded reports whether indexes were degraded.
+func (r *BuildReport) Degraded() bool {
+	return r.CompositeDropped || len(r.DroppedTokens) > 0
+}
+
+// IncompleteLabels returns labels whose tokens were dropped
+// and labels in composite indexes if they were dropped.
+func (r *BuildReport) IncompleteLabels() []string {
+	set := make(map[string]struct{}, len(r.DroppedTokens)+len(r.compositeIdxLabels))
+	for label := range r.DroppedTokens {
+		set[label] = struct{}{}
+	}
+	if r.CompositeDropped {
+		for _, label := range r.compositeIdxLabels {
+			set[label] = struct{}{}
+		}
+	}
+
+	labels := make([]string, 0, len(set))
+	for label := range set {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// MayBeIncomplete reports whether indexes of label can be degraded by the policy.
+// Labels in composite indexes can be incomplete with DropCompositeIndexes
+// since Filters use composite filters for them.
+func (p *BudgetPolicy) MayBeIncomplete(conf *Config, label string) bool {
+	if _, ok := p.Priorities[label]; ok {
+		return true
+	}
+	for _, s := range p.Strategies {
+		if s != DropCompositeIndexes {
+			continue
+		}
+		for _, l := range conf.withSchemaComposites().CompositeIdxLabels {
+			if l == label {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type budgetToken struct {
+	label    string
+	token    string
+	priority int
+	length   int
+}
+
+// degradableTokens returns tokens of labels in Priorities in order to drop.
+func (p *BudgetPolicy) degradableTokens(m indexesMap) []budgetToken {
+	var tokens []budgetToken
+	for label, priority := range p.Priorities {
+		for t := range m[label] {
+			tokens = append(tokens, budgetToken{label, t, priority, utf8.RuneCountInString(t)})
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		a, b := tokens[i], tokens[j]
+		switch {
+		case a.priority != b.priority:
+			return a.priority < b.priority
+		case a.label != b.label:
+			return a.label < b.label
+		case a.length != b.length:
+			return a.length > b.length
+		}
+		return a.token < b.token
+	})
+
+	return tokens
+}
+
+// degradableLabels returns labels in Priorities in order to drop.
+func (p *BudgetPolicy) degradableLabels() []string {
+	labels := make([]string, 0, len(p.Priorities))
+	for label := range p.Priorities {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		pi, pj := p.Priorities[labels[i]], p.Priorities[labels[j]]
+		if pi != pj {
+			return pi < pj
+		}
+		return labels[i] < labels[j]
+	})
+	return labels
+}
+
+// copyIndexesMap returns a deep copy of m.
+func copyIndexesMap(m indexesMap) indexesMap {
+	copied := make(indexesMap, len(m))
+	for label, tokens := range m {
+		copied[label] = make(map[string]struct{}, len(tokens))
+		for t := range tokens {
+			copied[label][t] = struct{}{}
+		}
+	}
+	return copied
+}
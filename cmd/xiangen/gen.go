@@ -0,0 +1,685 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/knightso/xian/internal/structtag"
+	"github.com/pkg/errors"
+)
+
+const (
+	xianPath      = "github.com/knightso/xian"
+	generatedMark = "// Code generated by xiangen; DO NOT EDIT."
+)
+
+// kind is how a value is converted into a token.
+type kind int
+
+const (
+	kindOther kind = iota // AddSomething
+	kindString
+	kindBool
+	kindInt
+	kindUint
+	kindTime
+	kindBit
+	kindStruct
+)
+
+// typeInfo describes a field type like T, *T, []T or []*T.
+type typeInfo struct {
+	ptr     bool
+	slice   bool
+	elemPtr bool
+	kind    kind
+	expr    string // source of T
+	imports map[string]string
+}
+
+type labelSpec struct {
+	structtag.Tag
+	name string // name of the label constant
+}
+
+type fieldSpec struct {
+	name   string
+	typ    *typeInfo
+	labels []*labelSpec
+	nested *structSpec
+}
+
+type structSpec struct {
+	name   string
+	fields []*fieldSpec
+}
+
+type generator struct {
+	pkg     string
+	decls   map[string]*ast.StructType
+	files   map[string]*ast.File // key=type name
+	specs   map[string]*structSpec
+	order   []*structSpec
+	visit   map[string]bool
+	imports map[string]string // key=name, value=path
+	buf     bytes.Buffer
+}
+
+// generate generates source of typed builders of types in dir.
+func generate(dir string, types []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, errors.Errorf("%d packages in %s", len(pkgs), dir)
+	}
+
+	g := &generator{
+		decls:   make(map[string]*ast.StructType),
+		files:   make(map[string]*ast.File),
+		specs:   make(map[string]*structSpec),
+		visit:   make(map[string]bool),
+		imports: map[string]string{"xian": xianPath},
+	}
+
+	for name, pkg := range pkgs {
+		g.pkg = name
+		for _, f := range pkg.Files {
+			if isGenerated(f) {
+				continue
+			}
+			for _, d := range f.Decls {
+				gd, ok := d.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, s := range gd.Specs {
+					ts := s.(*ast.TypeSpec)
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						g.decls[ts.Name.Name] = st
+						g.files[ts.Name.Name] = f
+					}
+				}
+			}
+		}
+	}
+
+	var roots []*structSpec
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if _, ok := g.decls[t]; !ok {
+			return nil, errors.Errorf("struct type %s not found", t)
+		}
+		spec, err := g.structSpec(t)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, spec)
+	}
+
+	g.generate(roots)
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "generated invalid source")
+	}
+	return src, nil
+}
+
+func isGenerated(f *ast.File) bool {
+	for _, c := range f.Comments {
+		for _, l := range c.List {
+			if l.Text == generatedMark {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// structSpec parses the struct type and nested structs recursively.
+func (g *generator) structSpec(name string) (*structSpec, error) {
+	if spec, ok := g.specs[name]; ok {
+		return spec, nil
+	}
+	if g.visit[name] {
+		return nil, errors.Errorf("recursive type %s", name)
+	}
+	g.visit[name] = true
+
+	spec := &structSpec{name: name}
+	consts := make(map[string]bool)
+
+	for _, f := range g.decls[name].Fields.List {
+		var tag string
+		tagged := false
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag, tagged = reflect.StructTag(s).Lookup(structtag.Name)
+		}
+		if tag == "-" {
+			continue
+		}
+
+		typ := g.typeInfo(g.files[name], f.Type)
+
+		names := make([]string, 0, len(f.Names))
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		if len(f.Names) == 0 {
+			// embedded
+			names = append(names, strings.TrimPrefix(typ.expr, "*"))
+		}
+
+		for _, n := range names {
+			if !ast.IsExported(n) {
+				continue
+			}
+
+			field := &fieldSpec{name: n, typ: typ}
+
+			if !tagged {
+				if typ.kind != kindStruct {
+					continue
+				}
+				nested, err := g.structSpec(typ.expr)
+				if err != nil {
+					return nil, err
+				}
+				if !nested.tagged() {
+					continue
+				}
+				field.nested = nested
+				spec.fields = append(spec.fields, field)
+				continue
+			}
+
+			labels, err := parseTag(tag)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s.%s", name, n)
+			}
+			for _, l := range labels {
+				if err := checkLabel(l, typ); err != nil {
+					return nil, errors.Wrapf(err, "%s.%s", name, n)
+				}
+				l.name = name + "Label" + n + labelSuffix(l)
+				if consts[l.name] {
+					return nil, errors.Errorf("duplicate label constant %s", l.name)
+				}
+				consts[l.name] = true
+			}
+			field.labels = labels
+			spec.fields = append(spec.fields, field)
+		}
+	}
+
+	g.specs[name] = spec
+	g.order = append(g.order, spec)
+	return spec, nil
+}
+
+func (s *structSpec) tagged() bool {
+	return len(s.fields) > 0
+}
+
+// parseTag parses a tag like `xian:"ti,bigrams,biunigrams;tp,prefixes"`.
+func parseTag(tag string) ([]*labelSpec, error) {
+	tags, err := structtag.Parse(tag)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]*labelSpec, 0, len(tags))
+	for _, t := range tags {
+		labels = append(labels, &labelSpec{Tag: t})
+	}
+	return labels, nil
+}
+
+func checkLabel(l *labelSpec, typ *typeInfo) error {
+	switch {
+	case typ.kind == kindStruct:
+		return errors.New("tagged struct")
+	case l.In != "" && len(l.Options) > 0:
+		return errors.Errorf("in option with %v", l.Options)
+	case l.In != "" && typ.kind != kindBit:
+		return errors.Errorf("in option for %s", typ.expr)
+	case l.In != "" && typ.slice && typ.elemPtr:
+		return errors.Errorf("in option for []*%s", typ.expr)
+	case len(l.Options) > 0 && typ.kind != kindString:
+		return errors.Errorf("options %v for %s", l.Options, typ.expr)
+	}
+	return nil
+}
+
+func labelSuffix(l *labelSpec) string {
+	switch {
+	case l.In != "":
+		return "In"
+	case len(l.Options) == 0:
+		return ""
+	}
+	switch l.Options[0] {
+	case structtag.Prefixes:
+		return "Prefix"
+	case structtag.Suffixes:
+		return "Suffix"
+	}
+	return "Partial"
+}
+
+// typeInfo resolves the type expression in f.
+func (g *generator) typeInfo(f *ast.File, expr ast.Expr) *typeInfo {
+	typ := &typeInfo{}
+
+	if s, ok := expr.(*ast.StarExpr); ok {
+		typ.ptr = true
+		expr = s.X
+	} else if a, ok := expr.(*ast.ArrayType); ok && a.Len == nil {
+		typ.slice = true
+		expr = a.Elt
+		if s, ok := expr.(*ast.StarExpr); ok {
+			typ.elemPtr = true
+			expr = s.X
+		}
+	}
+
+	switch e := expr.(type) {
+	case *ast.Ident:
+		typ.expr = e.Name
+		switch e.Name {
+		case "string":
+			typ.kind = kindString
+		case "bool":
+			typ.kind = kindBool
+		case "int", "int8", "int16", "int32", "int64":
+			typ.kind = kindInt
+		case "uint", "uint8", "uint16", "uint32", "uint64":
+			typ.kind = kindUint
+		default:
+			if _, ok := g.decls[e.Name]; ok {
+				typ.kind = kindStruct
+			}
+		}
+	case *ast.SelectorExpr:
+		pkg, ok := e.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		path := importPath(f, pkg.Name)
+		switch {
+		case path == "time" && e.Sel.Name == "Time":
+			typ.kind = kindTime
+			typ.expr = "time.Time"
+			typ.imports = map[string]string{"time": "time"}
+		case path == xianPath && e.Sel.Name == "Bit":
+			typ.kind = kindBit
+			typ.expr = "xian.Bit"
+		default:
+			typ.expr = pkg.Name + "." + e.Sel.Name
+			typ.imports = map[string]string{pkg.Name: path}
+		}
+	default:
+		var buf bytes.Buffer
+		format.Node(&buf, token.NewFileSet(), expr)
+		typ.expr = buf.String()
+	}
+
+	return typ
+}
+
+func importPath(f *ast.File, name string) string {
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		n := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			n = imp.Name.Name
+		}
+		if n == name {
+			return path
+		}
+	}
+	return ""
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate(roots []*structSpec) {
+	for _, spec := range g.order {
+		g.generateLabels(spec)
+		g.generateIndexes(spec)
+	}
+	for _, spec := range roots {
+		g.generateQuery(spec)
+	}
+
+	// imports are collected while generating the body.
+	body := append([]byte(nil), g.buf.Bytes()...)
+	g.buf.Reset()
+
+	g.printf("%s\n\n", generatedMark)
+	g.printf("package %s\n\n", g.pkg)
+
+	var std, others []string
+	for name, path := range g.imports {
+		if strings.Contains(path, ".") {
+			others = append(others, name)
+		} else {
+			std = append(std, name)
+		}
+	}
+	sort.Slice(std, func(i, j int) bool { return g.imports[std[i]] < g.imports[std[j]] })
+	sort.Slice(others, func(i, j int) bool { return g.imports[others[i]] < g.imports[others[j]] })
+
+	g.printf("import (\n")
+	for i, names := range [][]string{std, others} {
+		if i > 0 && len(std) > 0 {
+			g.printf("\n")
+		}
+		for _, name := range names {
+			path := g.imports[name]
+			if path[strings.LastIndex(path, "/")+1:] == name {
+				g.printf("%q\n", path)
+			} else {
+				g.printf("%s %q\n", name, path)
+			}
+		}
+	}
+	g.printf(")\n\n")
+
+	g.buf.Write(body)
+}
+
+func (g *generator) generateLabels(spec *structSpec) {
+	var labels []*labelSpec
+	for _, f := range spec.fields {
+		labels = append(labels, f.labels...)
+	}
+	if len(labels) == 0 {
+		return
+	}
+
+	g.printf("// Labels of %s.\n", spec.name)
+	g.printf("const (\n")
+	for _, l := range labels {
+		g.printf("%s = %q\n", l.name, l.Label)
+	}
+	g.printf(")\n\n")
+}
+
+func (g *generator) generateIndexes(spec *structSpec) {
+	g.printf("// BuildIndexes builds indexes of v.\n")
+	g.printf("func (v *%s) BuildIndexes(conf *xian.Config) ([]string, error) {\n", spec.name)
+	g.printf("idxs := xian.NewIndexes(conf)\n")
+	g.printf("v.AddIndexes(idxs)\n")
+	g.printf("return idxs.Build()\n")
+	g.printf("}\n\n")
+
+	g.printf("// AddIndexes adds indexes of v to idxs.\n")
+	g.printf("func (v *%s) AddIndexes(idxs *xian.Indexes) {\n", spec.name)
+	for _, f := range spec.fields {
+		x := "v." + f.name
+
+		if f.nested != nil {
+			g.forEach(f.typ, x, true, func(e string) {
+				g.printf("%s.AddIndexes(idxs)\n", e)
+			})
+			continue
+		}
+
+		for _, l := range f.labels {
+			if l.In != "" {
+				switch {
+				case f.typ.slice:
+					g.printf("idxs.Add(%s, %s.Indexes(%s...)...)\n", l.name, l.In, x)
+				case f.typ.ptr:
+					g.printf("if %s != nil {\n", x)
+					g.printf("idxs.Add(%s, %s.Indexes(*%s)...)\n", l.name, l.In, x)
+					g.printf("}\n")
+				default:
+					g.printf("idxs.Add(%s, %s.Indexes(%s)...)\n", l.name, l.In, x)
+				}
+				continue
+			}
+
+			l := l
+			g.forEach(f.typ, x, false, func(e string) {
+				g.addValue("idxs", l, f.typ, e)
+			})
+		}
+	}
+	g.printf("}\n\n")
+}
+
+// forEach prints statements for each non-nil element of x.
+// addressable requests pointers to struct elements.
+func (g *generator) forEach(typ *typeInfo, x string, addressable bool, fn func(e string)) {
+	switch {
+	case typ.slice && typ.elemPtr:
+		g.printf("for _, e := range %s {\n", x)
+		g.printf("if e != nil {\n")
+		if addressable {
+			fn("e")
+		} else {
+			fn("*e")
+		}
+		g.printf("}\n")
+		g.printf("}\n")
+	case typ.slice:
+		if addressable {
+			g.printf("for i := range %s {\n", x)
+			fn("(&" + x + "[i])")
+		} else {
+			g.printf("for _, e := range %s {\n", x)
+			fn("e")
+		}
+		g.printf("}\n")
+	case typ.ptr:
+		g.printf("if %s != nil {\n", x)
+		if addressable {
+			fn(x)
+		} else {
+			fn("*" + x)
+		}
+		g.printf("}\n")
+	default:
+		if addressable {
+			fn("(&" + x + ")")
+		} else {
+			fn(x)
+		}
+	}
+}
+
+// addValue prints statements adding e to recv which is Indexes or Filters.
+func (g *generator) addValue(recv string, l *labelSpec, typ *typeInfo, e string) {
+	if len(l.Options) > 0 {
+		for _, o := range l.Options {
+			g.printf("%s.%s(%s, %s)\n", recv, optionMethod(recv, o), l.name, e)
+		}
+		return
+	}
+
+	for name, path := range typ.imports {
+		if typ.kind == kindOther {
+			g.imports[name] = path
+		}
+	}
+
+	switch typ.kind {
+	case kindString:
+		g.printf("%s.Add(%s, %s)\n", recv, l.name, e)
+	case kindBool:
+		g.imports["strconv"] = "strconv"
+		g.printf("%s.Add(%s, strconv.FormatBool(%s))\n", recv, l.name, e)
+	case kindInt:
+		g.imports["strconv"] = "strconv"
+		g.printf("%s.Add(%s, strconv.FormatInt(int64(%s), 10))\n", recv, l.name, e)
+	case kindUint:
+		g.imports["strconv"] = "strconv"
+		g.printf("%s.Add(%s, strconv.FormatUint(uint64(%s), 10))\n", recv, l.name, e)
+	case kindTime:
+		g.imports["strconv"] = "strconv"
+		g.printf("%s.Add(%s, strconv.FormatInt(%s.UnixNano(), 10))\n", recv, l.name, e)
+	default:
+		g.printf("%s.AddSomething(%s, %s)\n", recv, l.name, e)
+	}
+}
+
+func optionMethod(recv, option string) string {
+	switch option {
+	case structtag.Bigrams:
+		return "AddBigrams"
+	case structtag.Biunigrams:
+		return "AddBiunigrams"
+	case structtag.Prefixes:
+		if recv == "idxs" {
+			return "AddPrefixes"
+		}
+		return "AddPrefix"
+	case structtag.Suffixes:
+		if recv == "idxs" {
+			return "AddSuffixes"
+		}
+		return "AddSuffix"
+	}
+	panic(fmt.Sprintf("unexpected option %q", option))
+}
+
+// queryMethod is a method of the query builder.
+type queryMethod struct {
+	name  string
+	label *labelSpec
+	typ   *typeInfo
+	kind  string // Equals, Contains, HasPrefix, HasSuffix or In
+}
+
+// queryMethods returns methods for fields of spec and nested structs.
+func queryMethods(spec *structSpec, prefix string) []*queryMethod {
+	var methods []*queryMethod
+	for _, f := range spec.fields {
+		if f.nested != nil {
+			methods = append(methods, queryMethods(f.nested, prefix+f.name)...)
+			continue
+		}
+
+		for _, l := range f.labels {
+			add := func(kind string) {
+				methods = append(methods, &queryMethod{prefix + f.name + kind, l, f.typ, kind})
+			}
+			switch {
+			case l.In != "":
+				add("In")
+			case len(l.Options) == 0:
+				add("Equals")
+			default:
+				partial := false
+				for _, o := range l.Options {
+					switch o {
+					case structtag.Bigrams, structtag.Biunigrams:
+						if !partial {
+							add("Contains")
+							partial = true
+						}
+					case structtag.Prefixes:
+						add("HasPrefix")
+					case structtag.Suffixes:
+						add("HasSuffix")
+					}
+				}
+			}
+		}
+	}
+	return methods
+}
+
+func (g *generator) generateQuery(spec *structSpec) {
+	q := spec.name + "Query"
+
+	g.printf("// %s is a typed filters builder of %s.\n", q, spec.name)
+	g.printf("type %s struct {\n", q)
+	g.printf("filters *xian.Filters\n")
+	g.printf("}\n\n")
+
+	g.printf("// New%s creates %s.\n", q, q)
+	g.printf("func New%s(conf *xian.Config) *%s {\n", q, q)
+	g.printf("return &%s{filters: xian.NewFilters(conf)}\n", q)
+	g.printf("}\n\n")
+
+	g.printf("// Filters returns the underlying filters.\n")
+	g.printf("func (q *%s) Filters() *xian.Filters {\n", q)
+	g.printf("return q.filters\n")
+	g.printf("}\n\n")
+
+	g.printf("// Build builds filters.\n")
+	g.printf("func (q *%s) Build() ([]string, error) {\n", q)
+	g.printf("return q.filters.Build()\n")
+	g.printf("}\n\n")
+
+	seen := make(map[string]bool)
+	for _, m := range queryMethods(spec, "") {
+		if seen[m.name] {
+			// the same method for another label, e.g. Contains of bigrams and biunigrams labels.
+			continue
+		}
+		seen[m.name] = true
+
+		switch m.kind {
+		case "In":
+			g.printf("// %s filters with any of bits.\n", m.name)
+			g.printf("// It panics if bits span groups of the InBuilder.\n")
+			g.printf("func (q *%s) %s(bits ...xian.Bit) *%s {\n", q, m.name, q)
+			g.printf("q.filters.Add(%s, %s.Filter(bits...))\n", m.label.name, m.label.In)
+		case "Equals":
+			for name, path := range m.typ.imports {
+				g.imports[name] = path
+			}
+			g.printf("// %s filters with v.\n", m.name)
+			g.printf("func (q *%s) %s(v %s) *%s {\n", q, m.name, m.typ.expr, q)
+			g.addValue("q.filters", m.label, m.typ, "v")
+		default:
+			g.printf("// %s filters with s.\n", m.name)
+			g.printf("func (q *%s) %s(s string) *%s {\n", q, m.name, q)
+			g.generateTextFilters(spec, m)
+		}
+		g.printf("return q\n")
+		g.printf("}\n\n")
+	}
+}
+
+// generateTextFilters prints filters of all labels of the field with the same method kind.
+func (g *generator) generateTextFilters(spec *structSpec, m *queryMethod) {
+	for _, other := range queryMethods(spec, "") {
+		if other.name != m.name {
+			continue
+		}
+		for _, o := range other.label.Options {
+			switch {
+			case m.kind == "Contains" && (o == structtag.Bigrams || o == structtag.Biunigrams),
+				m.kind == "HasPrefix" && o == structtag.Prefixes:
+				g.printf("q.filters.%s(%s, s)\n", optionMethod("q.filters", o), other.label.name)
+			case m.kind == "HasSuffix" && o == structtag.Suffixes:
+				// suffix tokens are reversed words.
+				g.printf("q.filters.%s(%s, xian.ReverseSuffix(s))\n", optionMethod("q.filters", o), other.label.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join("testdata", "books")
+	golden := filepath.Join(dir, "book_xian.go.golden")
+
+	src, err := generate(dir, []string{"Book"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if *update {
+		if err := ioutil.WriteFile(golden, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, expected) {
+		t.Errorf("generated source differs from %s. run with -update if it's expected.\n%s", golden, src)
+	}
+
+	t.Run("型チェック", func(t *testing.T) {
+		typeCheck(t, dir, src)
+	})
+}
+
+// typeCheck type-checks the package in dir with the generated source.
+func typeCheck(t *testing.T, dir string, src []byte) {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := parser.ParseFile(fset, "generated.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []*ast.File{generated}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			files = append(files, f)
+		}
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check(generated.Name.Name, fset, files, nil); err != nil {
+		t.Errorf("generated source doesn't compile: %v", err)
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		typ  string
+	}{
+		{"型がない場合", "Unknown"},
+		{"不正なタグ", "InvalidTag"},
+		{"inオプションの型が不正", "InvalidIn"},
+		{"ラベル定数の重複", "DuplicateLabel"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := generate(filepath.Join("testdata", "invalid"), []string{tc.typ}); err == nil {
+				t.Error("error = nil, wants != nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Command xiangen generates typed index and filter builders of xian for tagged structs.
+//
+// Usage:
+//
+//	//go:generate xiangen -type Book
+//
+//	xiangen -type Book[,Type...] [-output book_xian.go] [dir]
+//
+// Fields are tagged in the same way as xian.Indexes.AddStruct.
+//
+//	type Book struct {
+//		Title  string     `xian:"ti,bigrams,biunigrams;tp,prefixes"`
+//		Status xian.Bit   `xian:"s,in=statusInBuilder"`
+//		Price  int        `xian:"pr"`
+//		Author Author     // untagged structs of the package are generated recursively
+//	}
+//
+// The in option names a package-level *xian.InBuilder variable for xian.Bit fields.
+//
+// For each type it generates label constants like BookLabelTitlePartial,
+// a method BuildIndexes(conf *xian.Config) ([]string, error) and
+// a query builder created by NewBookQuery(conf *xian.Config) with methods like
+// TitleContains(s string), TitleHasPrefix(s string), StatusIn(bits ...xian.Bit) and PriceEquals(v int).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	types := flag.String("type", "", "comma-separated list of type names; must be set")
+	output := flag.String("output", "", "output file name; default <dir>/<type>_xian.go")
+	flag.Parse()
+
+	if *types == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	if err := run(dir, strings.Split(*types, ","), *output); err != nil {
+		fmt.Fprintln(os.Stderr, "xiangen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, types []string, output string) error {
+	src, err := generate(dir, types)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		output = filepath.Join(dir, strings.ToLower(types[0])+"_xian.go")
+	}
+
+	return ioutil.WriteFile(output, src, 0644)
+}
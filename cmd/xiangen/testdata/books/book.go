@@ -0,0 +1,32 @@
+package books
+
+import (
+	"time"
+
+	"github.com/knightso/xian"
+)
+
+var statusInBuilder = xian.NewInBuilder()
+
+var (
+	StatusPublished   = statusInBuilder.NewBit()
+	StatusUnpublished = statusInBuilder.NewBit()
+)
+
+type Author struct {
+	Name string `xian:"au"`
+	Age  *int   `xian:"ag"`
+}
+
+type Book struct {
+	Title    string    `xian:"ti,bigrams,biunigrams;tp,prefixes;ts,suffixes"`
+	Status   xian.Bit  `xian:"s,in=statusInBuilder"`
+	Tags     []string  `xian:"tg"`
+	Price    *int      `xian:"pr"`
+	Hobby    bool      `xian:"h"`
+	Released time.Time `xian:"r"`
+	Score    float64   `xian:"sc"`
+	Authors  []Author
+	Editor   *Author
+	Indexes  []string `xian:"-"`
+}
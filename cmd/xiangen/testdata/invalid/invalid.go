@@ -0,0 +1,13 @@
+package invalid
+
+type InvalidTag struct {
+	Title string `xian:"ti,trigrams"`
+}
+
+type InvalidIn struct {
+	Status string `xian:"s,in=statusInBuilder"`
+}
+
+type DuplicateLabel struct {
+	Title string `xian:"ti,bigrams;tb,biunigrams"`
+}
@@ -0,0 +1,72 @@
+// Command xianplan recommends composite index combinations of xian from sample queries.
+//
+// Usage:
+//
+//	xianplan [-budget 512] [-max-size 3] [-ignore-case] [-save-no-filters] < input.json
+//
+// The input is a JSON object of sample queries and the average number of tokens per entity for each label.
+//
+//	{
+//	  "queries": [{"labels": ["s", "c"], "weight": 10}, {"labels": ["s", "c", "p"]}],
+//	  "cardinalities": {"s": 4, "c": 1, "p": 1, "ti": 30}
+//	}
+//
+// It prints the planned xian.Config and the summary as JSON.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/knightso/xian"
+	"github.com/knightso/xian/planner"
+)
+
+type input struct {
+	Queries       []planner.Query    `json:"queries"`
+	Cardinalities map[string]float64 `json:"cardinalities"`
+}
+
+type output struct {
+	Config *xian.Config    `json:"config"`
+	Plan   *planner.Result `json:"plan"`
+}
+
+func main() {
+	budget := flag.Int("budget", xian.MaxIndexesSize, "maximum number of indexes per entity")
+	maxSize := flag.Int("max-size", planner.DefaultMaxCombinationSize, "maximum number of labels in a combination")
+	ignoreCase := flag.Bool("ignore-case", false, "set IgnoreCase of the config")
+	saveNoFilters := flag.Bool("save-no-filters", false, "set SaveNoFiltersIndex of the config")
+	flag.Parse()
+
+	if err := run(os.Stdin, os.Stdout, *budget, *maxSize, &xian.Config{
+		IgnoreCase:         *ignoreCase,
+		SaveNoFiltersIndex: *saveNoFilters,
+	}); err != nil {
+		fmt.Fprintln(os.Stderr, "xianplan:", err)
+		os.Exit(1)
+	}
+}
+
+func run(r io.Reader, w io.Writer, budget, maxSize int, base *xian.Config) error {
+	var in input
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return err
+	}
+
+	result, err := planner.Plan(in.Queries, in.Cardinalities, &planner.Options{
+		Budget:             budget,
+		MaxCombinationSize: maxSize,
+		Base:               base,
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&output{Config: result.Config, Plan: result})
+}
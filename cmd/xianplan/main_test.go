@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/knightso/xian"
+)
+
+func TestRun(t *testing.T) {
+	in := `{
+  "queries": [{"labels": ["s", "c"], "weight": 10}, {"labels": ["s", "c", "p"]}, {"labels": ["ti"]}],
+  "cardinalities": {"s": 4, "c": 1, "p": 1, "ti": 30}
+}`
+
+	var out bytes.Buffer
+	if err := run(strings.NewReader(in), &out, xian.MaxIndexesSize, 3, &xian.Config{IgnoreCase: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var result output
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("invalid output: %v\n%s", err, out.String())
+	}
+
+	expected := [][]string{{"c", "s"}, {"c", "p", "s"}}
+	if !reflect.DeepEqual(result.Config.CompositeIdxCombinations, expected) {
+		t.Errorf("unexpected, actual: `%v`, expected: `%v`", result.Config.CompositeIdxCombinations, expected)
+	}
+	if n := len(result.Plan.Combinations); n != 2 {
+		t.Errorf("len(Combinations) expected:%d, but was:%d", 2, n)
+	}
+	if !result.Config.IgnoreCase {
+		t.Error("IgnoreCase is not set")
+	}
+	if _, err := xian.ValidateConfig(result.Config); err != nil {
+		t.Errorf("invalid config: %v", err)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	for _, in := range []string{
+		`{`,
+		`{"queries": [{"labels": ["s", "c"]}], "cardinalities": {"s": 4}}`,
+		`{"queries": [{"labels": ["s", "__c"]}], "cardinalities": {"s": 4, "__c": 1}}`,
+	} {
+		if err := run(strings.NewReader(in), &bytes.Buffer{}, xian.MaxIndexesSize, 3, &xian.Config{}); err == nil {
+			t.Errorf("%s: error = nil, wants != nil", in)
+		}
+	}
+}
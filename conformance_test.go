@@ -0,0 +1,264 @@
+package xian
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update testdata/conformance.json")
+
+// conformanceValue is values of a label.
+// Values of IN labels are names of bits.
+type conformanceValue struct {
+	Label  string   `json:"label"`
+	Values []string `json:"values"`
+}
+
+type conformanceCase struct {
+	Name    string             `json:"name"`
+	Entity  []conformanceValue `json:"entity"`
+	Query   []conformanceValue `json:"query"`
+	Indexes []string           `json:"indexes"`
+	Filters []string           `json:"filters"`
+	// Match reports whether all the filters are in the indexes.
+	Match bool `json:"match"`
+}
+
+// conformanceCorpus is a corpus for other implementations to verify tokens.
+type conformanceCorpus struct {
+	Description string             `json:"description"`
+	Config      *Config            `json:"config"`
+	Cases       []*conformanceCase `json:"cases"`
+}
+
+func newConformanceCorpus() *conformanceCorpus {
+	statuses := NewInBuilderWithConfig(&InConfig{GroupSize: CompactInGroupSize})
+	statuses.MustNewBitNamed("unpublished", 0)
+	statuses.MustNewBitNamed("published", 1)
+	statuses.MustNewBitNamed("discontinued", 2)
+	statuses.MustNewBitNamed("reserved", 4)
+
+	corpus := &conformanceCorpus{
+		Description: "Indexes are built with AddBiunigrams for partial, AddPrefixes for prefix, AddSuffixes for suffix, " +
+			"Add for exact and InBuilder.Indexes for exact labels with in. " +
+			"Filters are built with AddBiunigrams, AddPrefix, AddSuffix with reversed values, Add and InBuilder.Filter.",
+		Config: &Config{
+			IgnoreCase: true,
+			Schema: MustNewSchema(
+				&LabelSchema{Name: "ti", Kind: LabelPartial},
+				&LabelSchema{Name: "tp", Kind: LabelPrefix},
+				&LabelSchema{Name: "ts", Kind: LabelSuffix},
+				&LabelSchema{Name: "au", Kind: LabelExact, Normalization: NormalizeNone},
+				&LabelSchema{Name: "s", Kind: LabelExact, Composite: true, InBuilder: statuses},
+				&LabelSchema{Name: "c", Kind: LabelExact, Composite: true},
+				&LabelSchema{Name: "pr", Kind: LabelExact, Composite: true},
+			),
+		},
+	}
+
+	corpus.Cases = []*conformanceCase{
+		{
+			Name:   "partial",
+			Entity: []conformanceValue{{"ti", []string{"Harry Potter"}}},
+			Query:  []conformanceValue{{"ti", []string{"rry PO"}}},
+		},
+		{
+			Name:   "partial in another order",
+			Entity: []conformanceValue{{"ti", []string{"abcab"}}},
+			Query:  []conformanceValue{{"ti", []string{"cabc"}}},
+		},
+		{
+			Name:   "partial multibyte",
+			Entity: []conformanceValue{{"ti", []string{"ハリー・ポッター"}}},
+			Query:  []conformanceValue{{"ti", []string{"ポ"}}},
+		},
+		{
+			Name:   "prefix",
+			Entity: []conformanceValue{{"tp", []string{"Harry Potter"}}},
+			Query:  []conformanceValue{{"tp", []string{"pot"}}},
+		},
+		{
+			Name:   "suffix",
+			Entity: []conformanceValue{{"ts", []string{"Harry Potter"}}},
+			Query:  []conformanceValue{{"ts", []string{"rry"}}},
+		},
+		{
+			Name:   "exact without normalization",
+			Entity: []conformanceValue{{"au", []string{"J. K. Rowling", "Rowling"}}},
+			Query:  []conformanceValue{{"au", []string{"rowling"}}},
+		},
+		{
+			Name:   "in",
+			Entity: []conformanceValue{{"s", []string{"published"}}},
+			Query:  []conformanceValue{{"s", []string{"published", "unpublished"}}},
+		},
+		{
+			Name:   "in of another group",
+			Entity: []conformanceValue{{"s", []string{"reserved"}}},
+			Query:  []conformanceValue{{"s", []string{"reserved"}}},
+		},
+		{
+			Name: "composite",
+			Entity: []conformanceValue{
+				{"s", []string{"published"}},
+				{"c", []string{"Sports", "Cooking"}},
+				{"pr", []string{"p<3000"}},
+			},
+			Query: []conformanceValue{{"s", []string{"published", "discontinued"}}, {"c", []string{"cooking"}}},
+		},
+		{
+			Name:   "composite with a single label",
+			Entity: []conformanceValue{{"c", []string{"sports"}}, {"pr", []string{"p<3000"}}},
+			Query:  []conformanceValue{{"pr", []string{"p<3000"}}},
+		},
+	}
+
+	return corpus
+}
+
+// run builds indexes and filters of c.
+func (corpus *conformanceCorpus) run(t *testing.T, c *conformanceCase) (indexes, filters []string, match bool) {
+	t.Helper()
+
+	conf := MustValidateConfig(corpus.Config)
+
+	idxs := NewIndexes(conf)
+	for _, v := range c.Entity {
+		l, _ := conf.Schema.Label(v.Label)
+		switch {
+		case l.InBuilder != nil:
+			idxs.Add(v.Label, l.InBuilder.Indexes(conformanceBits(t, l.InBuilder, v.Values)...)...)
+		case l.Kind == LabelPartial:
+			for _, s := range v.Values {
+				idxs.AddBiunigrams(v.Label, s)
+			}
+		case l.Kind == LabelPrefix:
+			for _, s := range v.Values {
+				idxs.AddPrefixes(v.Label, s)
+			}
+		case l.Kind == LabelSuffix:
+			for _, s := range v.Values {
+				idxs.AddSuffixes(v.Label, s)
+			}
+		default:
+			idxs.Add(v.Label, v.Values...)
+		}
+	}
+
+	fs := NewFilters(conf)
+	for _, v := range c.Query {
+		l, _ := conf.Schema.Label(v.Label)
+		switch {
+		case l.InBuilder != nil:
+			fs.Add(v.Label, l.InBuilder.Filter(conformanceBits(t, l.InBuilder, v.Values)...))
+		case l.Kind == LabelPartial:
+			for _, s := range v.Values {
+				fs.AddBiunigrams(v.Label, s)
+			}
+		case l.Kind == LabelPrefix:
+			for _, s := range v.Values {
+				fs.AddPrefix(v.Label, s)
+			}
+		case l.Kind == LabelSuffix:
+			for _, s := range v.Values {
+				fs.AddSuffix(v.Label, ReverseSuffix(s))
+			}
+		default:
+			fs.Add(v.Label, v.Values...)
+		}
+	}
+
+	indexes, err := idxs.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	filters, err = fs.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(indexes)
+	sort.Strings(filters)
+
+	match = true
+	for _, f := range filters {
+		match = match && containsString(indexes, f)
+	}
+
+	return indexes, filters, match
+}
+
+func conformanceBits(t *testing.T, in *InBuilder, names []string) []Bit {
+	t.Helper()
+
+	bits := make([]Bit, 0, len(names))
+	for _, name := range names {
+		bit, ok := in.Bit(name)
+		if !ok {
+			t.Fatalf("unknown bit %q", name)
+		}
+		bits = append(bits, bit)
+	}
+	return bits
+}
+
+func TestConformance(t *testing.T) {
+	path := filepath.Join("testdata", "conformance.json")
+
+	if *update {
+		corpus := newConformanceCorpus()
+		for _, c := range corpus.Cases {
+			c.Indexes, c.Filters, c.Match = corpus.run(t, c)
+		}
+
+		b, err := json.MarshalIndent(corpus, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, append(b, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var corpus conformanceCorpus
+	if err := json.Unmarshal(b, &corpus); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range corpus.Cases {
+		t.Run(c.Name, func(t *testing.T) {
+			indexes, filters, match := corpus.run(t, c)
+			if !reflect.DeepEqual(indexes, c.Indexes) {
+				t.Errorf("indexes, actual: `%v`, expected: `%v`", indexes, c.Indexes)
+			}
+			if !reflect.DeepEqual(filters, c.Filters) {
+				t.Errorf("filters, actual: `%v`, expected: `%v`", filters, c.Filters)
+			}
+			assert(t, "match", match, c.Match)
+		})
+	}
+
+	t.Run("コーパスの入力が最新", func(t *testing.T) {
+		expected := newConformanceCorpus()
+		for i, c := range expected.Cases {
+			c.Indexes, c.Filters, c.Match = corpus.Cases[i].Indexes, corpus.Cases[i].Filters, corpus.Cases[i].Match
+		}
+		e, err := json.MarshalIndent(expected, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(append(e, '\n'), b) {
+			t.Errorf("%s is stale. run go test -run TestConformance -update", path)
+		}
+	})
+}
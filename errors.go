@@ -0,0 +1,79 @@
+package xian
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IndexSizeError is returned by Build when built indexes exceed MaxIndexesSize.
+type IndexSizeError struct {
+	// Size is the number of built indexes.
+	Size int
+	// Max is the maximum number of indexes.
+	Max int
+	// Labels is the number of indexes of each label, including composite indexes the label is combined in.
+	Labels map[string]int
+	// CompositeIndexes is the number of composite indexes.
+	CompositeIndexes int
+	// DegradedSize is the number of indexes degraded by Config.BudgetPolicy including IndexDegraded.
+	// It's zero if indexes were not degraded. The other fields describe indexes before degradation.
+	DegradedSize int
+}
+
+func (e *IndexSizeError) Error() string {
+	if e.DegradedSize > 0 {
+		return fmt.Sprintf("index size %d exceeds %d, degraded to %d", e.Size, e.Max, e.DegradedSize)
+	}
+	return fmt.Sprintf("index size %d exceeds %d", e.Size, e.Max)
+}
+
+// LargestLabels returns labels in descending order of the number of indexes.
+func (e *IndexSizeError) LargestLabels() []string {
+	labels := make([]string, 0, len(e.Labels))
+	for label := range e.Labels {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if e.Labels[labels[i]] != e.Labels[labels[j]] {
+			return e.Labels[labels[i]] > e.Labels[labels[j]]
+		}
+		return labels[i] < labels[j]
+	})
+	return labels
+}
+
+// newIndexSizeError counts indexes of each label in built.
+func newIndexSizeError(conf *Config, built []string, size int) *IndexSizeError {
+	e := &IndexSizeError{
+		Size:   size,
+		Max:    MaxIndexesSize,
+		Labels: make(map[string]int),
+	}
+	for _, idx := range built {
+		entry, err := ParseIndex(conf, idx)
+		if err != nil {
+			continue
+		}
+		switch entry.Kind {
+		case EntryLabel:
+			e.Labels[entry.Label]++
+		case EntryComposite:
+			e.CompositeIndexes++
+			for _, c := range entry.Components {
+				e.Labels[c.Label]++
+			}
+		}
+	}
+	return e
+}
+
+// ConfigError describes an invalid field of Config.
+type ConfigError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return strings.Join([]string{e.Field, e.Reason}, " ")
+}
@@ -0,0 +1,119 @@
+package xian
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestIndexSizeError(t *testing.T) {
+	t.Run("Indexes", func(t *testing.T) {
+		conf := &Config{CompositeIdxLabels: []string{"s", "c"}}
+		idxs := NewIndexes(conf).Add("s", "x", "y").Add("c", "z")
+		for i := 0; i < MaxIndexesSize; i++ {
+			idxs.Add("t", fmt.Sprintf("%03d", i))
+		}
+
+		_, err := idxs.Build()
+		var serr *IndexSizeError
+		if !errors.As(errors.Wrap(err, "wrapped"), &serr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert(t, "Size", serr.Size, MaxIndexesSize+5)
+		assert(t, "Max", serr.Max, MaxIndexesSize)
+		assert(t, "CompositeIndexes", serr.CompositeIndexes, 2)
+		assert(t, "Labels[t]", serr.Labels["t"], MaxIndexesSize)
+		assert(t, "Labels[s]", serr.Labels["s"], 4)
+		assert(t, "Labels[c]", serr.Labels["c"], 3)
+		assert(t, "LargestLabels", fmt.Sprint(serr.LargestLabels()), "[t s c]")
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		filters := NewFilters(nil)
+		for i := 0; i < MaxIndexesSize+1; i++ {
+			filters.Add(fmt.Sprintf("label%d", i%2), fmt.Sprintf("%03d", i))
+		}
+
+		_, err := filters.Build()
+		var serr *IndexSizeError
+		if !errors.As(err, &serr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert(t, "Size", serr.Size, MaxIndexesSize+1)
+		assert(t, "Labels[label0]", serr.Labels["label0"], MaxIndexesSize/2+1)
+		assert(t, "Labels[label1]", serr.Labels["label1"], MaxIndexesSize/2)
+	})
+
+	t.Run("BudgetPolicyで減らせない場合", func(t *testing.T) {
+		conf := &Config{
+			CompositeIdxLabels: []string{"s", "c"},
+			BudgetPolicy: &BudgetPolicy{
+				Strategies: []BudgetStrategy{DropCompositeIndexes, DropLabels},
+				Priorities: map[string]int{"c": 1},
+			},
+		}
+		idxs := NewIndexes(conf)
+		for i := 0; i < MaxIndexesSize; i++ {
+			idxs.Add("t", fmt.Sprintf("%03d", i))
+		}
+		for i := 0; i < 10; i++ {
+			idxs.Add("s", fmt.Sprintf("s%d", i)).Add("c", fmt.Sprintf("c%d", i))
+		}
+
+		_, err := idxs.Build()
+		var serr *IndexSizeError
+		if !errors.As(err, &serr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// counts before degradation
+		assert(t, "Size", serr.Size, MaxIndexesSize+10+10+100)
+		assert(t, "CompositeIndexes", serr.CompositeIndexes, 100)
+		assert(t, "Labels[c]", serr.Labels["c"], 110)
+		assert(t, "LargestLabels", fmt.Sprint(serr.LargestLabels()), "[t c s]")
+		assert(t, "DegradedSize", serr.DegradedSize, MaxIndexesSize+10+1)
+	})
+}
+
+func TestConfigError(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		conf  *Config
+		field string
+	}{
+		{"CompositeIdxMaxSizeが小さい場合", &Config{CompositeIdxLabels: []string{"a", "b"}, CompositeIdxMaxSize: 1}, "CompositeIdxMaxSize"},
+		{"CompositeIdxMaxSizeとCompositeIdxCombinations", &Config{
+			CompositeIdxLabels:       []string{"a", "b"},
+			CompositeIdxMaxSize:      2,
+			CompositeIdxCombinations: [][]string{{"a", "b"}},
+		}, "CompositeIdxMaxSize"},
+		{"CompositeIdxCombinationsのラベルが1つの場合", &Config{
+			CompositeIdxLabels:       []string{"a", "b"},
+			CompositeIdxCombinations: [][]string{{"a"}},
+		}, "CompositeIdxCombinations"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ValidateConfig(tc.conf)
+			var cerr *ConfigError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assert(t, "Field", cerr.Field, tc.field)
+		})
+	}
+
+	t.Run("Buildの場合", func(t *testing.T) {
+		labels := make([]string, MaxCompositeIndexLabels+1)
+		for i := range labels {
+			labels[i] = string(rune('a' + i))
+		}
+
+		_, err := NewFilters(&Config{CompositeIdxLabels: labels}).Add("a", "x").Build()
+		var cerr *ConfigError
+		if !errors.As(err, &cerr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert(t, "Field", cerr.Field, "CompositeIdxLabels")
+		assert(t, "Error", err.Error(), fmt.Sprintf("CompositeIdxLabels size exceeds %d", MaxCompositeIndexLabels))
+	})
+}
@@ -0,0 +1,36 @@
+package xian
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var separatorEscaper = strings.NewReplacer("%", "%25", " ", "%20", combiIndexSeperator, "%3B")
+
+// escapeLabel escapes label with Config.EscapeSeparators.
+func (conf *Config) escapeLabel(label string) string {
+	if !conf.EscapeSeparators {
+		return label
+	}
+	if isDigits(label) {
+		return fmt.Sprintf("%%%02X", label[0]) + label[1:]
+	}
+	return separatorEscaper.Replace(label)
+}
+
+// escapeToken escapes token with Config.EscapeSeparators.
+func (conf *Config) escapeToken(token string) string {
+	if !conf.EscapeSeparators {
+		return token
+	}
+	return separatorEscaper.Replace(token)
+}
+
+// unescape decodes a label or a token escaped with Config.EscapeSeparators.
+func (conf *Config) unescape(s string) (string, error) {
+	if !conf.EscapeSeparators {
+		return s, nil
+	}
+	return url.PathUnescape(s)
+}
@@ -0,0 +1,75 @@
+package xian
+
+import (
+	"testing"
+)
+
+func TestEscapeSeparators(t *testing.T) {
+	t.Run("互換モードでは衝突する", func(t *testing.T) {
+		conf := &Config{CompositeIdxLabels: []string{"s", "c"}}
+		built1 := NewIndexes(conf).Add("s", "1;2").Add("c", "x").MustBuild()
+		built2 := NewIndexes(conf).Add("s", "1").Add("c", "2;x").MustBuild()
+		assert(t, "collision", containsString(built1, "3 1;2;x") && containsString(built2, "3 1;2;x"), true)
+
+		if _, err := NewIndexes(nil).Add("a b", "c").Build(); err == nil {
+			t.Error("error = nil, wants != nil")
+		}
+	})
+
+	conf := &Config{EscapeSeparators: true, CompositeIdxLabels: []string{"s", "c"}}
+
+	t.Run("ラベルとトークン", func(t *testing.T) {
+		built := NewIndexes(conf).Add("a b", "c").Add("a", "b c").Add("3", "x").Add("p", "100%").MustBuild()
+		assertBuiltIndex(t, built, []string{"a%20b c", "a b%20c", "%33 x", "p 100%25"})
+
+		entries, err := ParseIndexes(conf, built)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		found := make(map[string]string)
+		for _, e := range entries {
+			assert(t, "Kind", e.Kind, EntryLabel)
+			found[e.Label] = e.Token
+		}
+		assert(t, "a b", found["a b"], "c")
+		assert(t, "a", found["a"], "b c")
+		assert(t, "3", found["3"], "x")
+		assert(t, "p", found["p"], "100%")
+	})
+
+	t.Run("複合インデックス", func(t *testing.T) {
+		built := NewIndexes(conf).Add("s", "1;2").Add("c", "x y").MustBuild()
+		assertBuiltIndex(t, built, []string{"s 1%3B2", "c x%20y", "3 1%3B2;x%20y"})
+
+		entry, err := ParseIndex(conf, "3 1%3B2;x%20y")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert(t, "s", entry.Components[0].Token, "1;2")
+		assert(t, "c", entry.Components[1].Token, "x y")
+
+		filters := NewFilters(conf).Add("s", "1;2").Add("c", "x y").MustBuild()
+		assertBuiltFilter(t, filters, []string{"3 1%3B2;x%20y"})
+	})
+
+	t.Run("フィルタ", func(t *testing.T) {
+		idxs := NewIndexes(conf).AddBiunigrams("ti", "a b%").AddPrefixes("tp", "x;y").MustBuild()
+		for _, f := range NewFilters(conf).AddBiunigrams("ti", "a b%").AddPrefix("tp", "x;y").MustBuild() {
+			if !containsString(idxs, f) {
+				t.Errorf("filter: %s not contains", f)
+			}
+		}
+	})
+
+	t.Run("不正なエスケープ", func(t *testing.T) {
+		if _, err := ParseIndex(conf, "a %zz"); err == nil {
+			t.Error("error = nil, wants != nil")
+		}
+	})
+
+	t.Run("フィンガープリント", func(t *testing.T) {
+		if conf.Fingerprint() == (&Config{CompositeIdxLabels: []string{"s", "c"}}).Fingerprint() {
+			t.Error("fingerprint not changed")
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package xian
+
+import (
+	"sort"
+)
+
+// FacetLabel describes a label to count facets for.
+//
+// Labels of exact values such as Add and AddSomething are facetable.
+// Labels of partial, prefix and suffix match tokens are not facetable
+// since their tokens are fragments of values.
+type FacetLabel struct {
+	// Label is the label of indexes.
+	Label string
+	// InBuilder decodes IN indexes of the label. It's nil for labels of plain values.
+	InBuilder *InBuilder
+	// Names maps bits to facet values for IN indexes.
+	// Names of InBuilder or filter tokens are used for bits without names.
+	Names map[Bit]string
+}
+
+// FacetCount is a count of entities for a facet value.
+type FacetCount struct {
+	Value string
+	Count int
+}
+
+// Facets counts facet values from built indexes of result entities.
+// Facets is not safe for concurrent use.
+type Facets struct {
+	labels map[string]FacetLabel
+	counts map[string]map[string]int // key=label, value=(key=value, value=count)
+	conf   *Config
+}
+
+// NewFacets creates and initializes a new Facets for labels.
+// conf should be the same as the one used to build indexes.
+func NewFacets(conf *Config, labels ...FacetLabel) *Facets {
+	if conf == nil {
+		conf = DefaultConfig
+	}
+
+	f := &Facets{
+		labels: make(map[string]FacetLabel, len(labels)),
+		counts: make(map[string]map[string]int, len(labels)),
+		conf:   conf,
+	}
+	for _, l := range labels {
+		f.labels[l.Label] = l
+		f.counts[l.Label] = make(map[string]int)
+	}
+
+	return f
+}
+
+// Add counts facet values from indexes of an entity built by Indexes.Build.
+// Composite indexes are ignored since single label indexes are always saved.
+func (f *Facets) Add(indexes []string) *Facets {
+	tokens := make(map[string][]string)
+
+	for _, idx := range indexes {
+		label, token, ok := f.conf.splitIndex(idx)
+		if !ok {
+			continue
+		}
+		if _, ok := f.labels[label]; !ok {
+			continue
+		}
+		tokens[label] = append(tokens[label], token)
+	}
+
+	for label, ts := range tokens {
+		fl := f.labels[label]
+		if fl.InBuilder == nil {
+			for _, t := range ts {
+				f.counts[label][t]++
+			}
+			continue
+		}
+		for _, bit := range fl.InBuilder.Decode(ts) {
+			f.counts[label][fl.valueOf(bit)]++
+		}
+	}
+
+	return f
+}
+
+func (fl FacetLabel) valueOf(bit Bit) string {
+	if name, ok := fl.Names[bit]; ok {
+		return name
+	}
+	if name, ok := fl.InBuilder.Name(bit); ok {
+		return name
+	}
+	return fl.InBuilder.Filter(bit)
+}
+
+// Counts returns counts of facet values of the label in descending order of counts.
+func (f *Facets) Counts(label string) []FacetCount {
+	counts := make([]FacetCount, 0, len(f.counts[label]))
+	for v, n := range f.counts[label] {
+		counts = append(counts, FacetCount{Value: v, Count: n})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+
+	return counts
+}
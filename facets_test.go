@@ -0,0 +1,69 @@
+package xian
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFacets(t *testing.T) {
+	inBuilder := NewInBuilder()
+	unpublished := inBuilder.NewBit()
+	published := inBuilder.NewBit()
+	discontinued := inBuilder.NewBit()
+
+	conf := &Config{
+		CompositeIdxLabels: []string{"s", "c"},
+		SaveNoFiltersIndex: true,
+	}
+
+	facets := NewFacets(conf,
+		FacetLabel{
+			Label:     "s",
+			InBuilder: inBuilder,
+			Names: map[Bit]string{
+				unpublished: "unpublished",
+				published:   "published",
+			},
+		},
+		FacetLabel{Label: "c"},
+	)
+
+	for _, e := range []struct {
+		status   Bit
+		category string
+	}{
+		{published, "sports"},
+		{published, "cooking"},
+		{published, "sports"},
+		{unpublished, "sports"},
+		{discontinued, "travel"},
+	} {
+		idxs := NewIndexes(conf).
+			Add("s", inBuilder.Indexes(e.status)...).
+			Add("c", e.category).
+			AddBigrams("ti", "abc")
+		facets.Add(idxs.MustBuild())
+	}
+
+	expected := []FacetCount{
+		{"published", 3},
+		{"4", 1},
+		{"unpublished", 1},
+	}
+	if counts := facets.Counts("s"); !reflect.DeepEqual(counts, expected) {
+		t.Errorf("unexpected, actual: `%v`, expected: `%v`", counts, expected)
+	}
+
+	expected = []FacetCount{
+		{"sports", 3},
+		{"cooking", 1},
+		{"travel", 1},
+	}
+	if counts := facets.Counts("c"); !reflect.DeepEqual(counts, expected) {
+		t.Errorf("unexpected, actual: `%v`, expected: `%v`", counts, expected)
+	}
+
+	if counts := facets.Counts("ti"); len(counts) != 0 {
+		t.Errorf("unexpected, actual: `%v`, expected: empty", counts)
+	}
+}
@@ -3,17 +3,23 @@ package xian
 import (
 	"fmt"
 	"reflect"
-	"strings"
+	"sort"
 	"time"
 	"unicode/utf8"
-
-	"github.com/pkg/errors"
 )
 
 // Filters is filters builder for extra indexes.
 type Filters struct {
-	m    indexesMap // key=label, value=index set
-	conf *Config
+	m     indexesMap  // key=label, value=index set
+	conds []condition // conditions for Matcher
+	conf  *Config
+
+	partials    map[string][]string // key=label, value=partial match tokens in order
+	fixed       indexesMap          // tokens added by other than partial match, never pruned
+	maxPartials int
+	selector    TokenSelector
+
+	err error // the first error of operations rejected by Config.Schema
 }
 
 // NewFilters creates and initializes a new Filters.
@@ -21,6 +27,7 @@ func NewFilters(conf *Config) *Filters {
 	if conf == nil {
 		conf = DefaultConfig
 	}
+	conf = conf.withSchemaComposites()
 	return &Filters{
 		m:    make(indexesMap),
 		conf: conf,
@@ -29,18 +36,56 @@ func NewFilters(conf *Config) *Filters {
 
 // Add adds new filters with a label.
 func (filters *Filters) Add(label string, indexes ...string) *Filters {
+	if filters.check(label, LabelExact) {
+		filters.add(label, indexes...)
+	}
+	return filters
+}
+
+// check reports whether an operation of kind on label is allowed by Config.Schema
+// and records the first error.
+func (filters *Filters) check(label string, kind LabelKind) bool {
+	if filters.err != nil {
+		return false
+	}
+	if err := filters.conf.checkLabel(label, kind); err != nil {
+		filters.err = err
+		return false
+	}
+	return true
+}
+
+// Err returns the first error of operations rejected by Config.Schema.
+func (filters *Filters) Err() error {
+	return filters.err
+}
+
+func (filters *Filters) add(label string, indexes ...string) {
+	filters.put(label, false, indexes...)
+}
+
+// put adds indexes. Indexes which are not partial are kept by LimitPartialFilters.
+func (filters *Filters) put(label string, partial bool, indexes ...string) {
 	for _, idx := range indexes {
-		if filters.conf.IgnoreCase {
-			idx = strings.ToLower(idx)
-		}
+		idx = filters.conf.normalize(label, idx)
 
 		if _, ok := filters.m[label]; !ok {
 			filters.m[label] = make(map[string]struct{})
 		}
 
 		filters.m[label][idx] = struct{}{}
+
+		if partial {
+			continue
+		}
+		if filters.fixed == nil {
+			filters.fixed = make(indexesMap)
+		}
+		if _, ok := filters.fixed[label]; !ok {
+			filters.fixed[label] = make(map[string]struct{})
+		}
+		filters.fixed[label][idx] = struct{}{}
 	}
-	return filters
 }
 
 // AddBigrams adds new bigram filters with a label.
@@ -52,66 +97,261 @@ func (filters *Filters) AddBigrams(label string, s string) *Filters {
 
 // AddBiunigrams adds new biunigram filters with a label.
 func (filters *Filters) AddBiunigrams(label string, s string) *Filters {
+	if !filters.check(label, LabelPartial) {
+		return filters
+	}
+
+	filters.addCondition(matchContains, label, s)
+
 	if runeLen := utf8.RuneCountInString(s); runeLen == 1 {
-		filters.Add(label, s)
+		filters.add(label, s)
 	} else if runeLen > 1 {
-		filters.Add(label, Bigrams(s)...)
+		filters.put(label, true, Bigrams(s)...)
+		filters.addPartials(label, orderedBigrams(s))
+	}
+	return filters
+}
+
+func (filters *Filters) addPartials(label string, tokens []string) {
+	if filters.partials == nil {
+		filters.partials = make(map[string][]string)
+	}
+
+	for _, t := range tokens {
+		t = filters.conf.normalize(label, t)
+		if !containsToken(filters.partials[label], t) {
+			filters.partials[label] = append(filters.partials[label], t)
+		}
+	}
+}
+
+// LimitPartialFilters limits the number of partial match filters of each label to max
+// in order to reduce zig-zag merge join latency of long queries.
+// selector chooses tokens to filter with. EvenlySpacedTokens is used if selector is nil.
+// Entities matched with the rest of tokens must be verified with Matcher.
+func (filters *Filters) LimitPartialFilters(max int, selector TokenSelector) *Filters {
+	if selector == nil {
+		selector = EvenlySpacedTokens
 	}
+	filters.maxPartials = max
+	filters.selector = selector
 	return filters
 }
 
+// PrunedTokens returns partial match tokens excluded by LimitPartialFilters.
+// Tokens also added by other than partial match are kept.
+// key=label, value=tokens
+func (filters *Filters) PrunedTokens() map[string][]string {
+	pruned := make(map[string][]string)
+
+	if filters.maxPartials <= 0 {
+		return pruned
+	}
+
+	for label, tokens := range filters.partials {
+		if len(tokens) <= filters.maxPartials {
+			continue
+		}
+		selected := filters.selector.SelectTokens(label, tokens, filters.maxPartials)
+		for _, t := range tokens {
+			if _, ok := filters.fixed[label][t]; ok {
+				continue
+			}
+			if !containsToken(selected, t) {
+				pruned[label] = append(pruned[label], t)
+			}
+		}
+	}
+
+	return pruned
+}
+
+// filterMap returns indexesMap to build excluding pruned tokens.
+func (filters *Filters) filterMap() indexesMap {
+	pruned := filters.PrunedTokens()
+	if len(pruned) == 0 {
+		return filters.m
+	}
+
+	m := make(indexesMap, len(filters.m))
+	for label, tokens := range filters.m {
+		m[label] = tokens
+	}
+
+	for label, tokens := range pruned {
+		set := make(map[string]struct{}, len(m[label]))
+		for t := range m[label] {
+			set[t] = struct{}{}
+		}
+		for _, t := range tokens {
+			delete(set, t)
+		}
+		m[label] = set
+	}
+
+	return m
+}
+
 // AddPrefix adds a new prefix filter with a label.
 func (filters *Filters) AddPrefix(label string, s string) *Filters {
+	if !filters.check(label, LabelPrefix) {
+		return filters
+	}
+
+	filters.addCondition(matchPrefix, label, s)
+
 	// don't need to split prefixes on filters
-	return filters.Add(label, s)
+	filters.add(label, s)
+	return filters
 }
 
 // AddSuffix adds a new suffix filter with a label.
+// s must be reversed like tokens of Indexes.AddSuffixes, e.g. ReverseSuffix("ter") for words ending with "ter".
 func (filters *Filters) AddSuffix(label string, s string) *Filters {
+	if !filters.check(label, LabelSuffix) {
+		return filters
+	}
+
+	filters.addCondition(matchSuffix, label, reverse(s))
+
 	// don't need to split suffixes on filters
-	return filters.Add(label, s)
+	filters.add(label, s)
+	return filters
+}
+
+func (filters *Filters) addCondition(kind matchKind, label string, s string) {
+	if s == "" {
+		return
+	}
+	filters.conds = append(filters.conds, condition{
+		kind:  kind,
+		label: label,
+		s:     filters.conf.normalize(label, s),
+	})
 }
 
 // AddSomething adds new indexes with a label.
 // The indexes can be a slice or a string convertible value.
 func (filters *Filters) AddSomething(label string, indexes interface{}) *Filters {
+	if !filters.check(label, LabelExact) {
+		return filters
+	}
 
 	v := reflect.ValueOf(indexes)
 
 	switch v.Kind() {
 	case reflect.Array, reflect.Slice:
 		for i := 0; i < v.Len(); i++ {
-			filters.Add(label, fmt.Sprintf("%v", v.Index(i).Interface()))
+			filters.add(label, fmt.Sprintf("%v", v.Index(i).Interface()))
 		}
 	case timeKind:
 		unix := v.Interface().(time.Time).UnixNano()
-		filters.Add(label, fmt.Sprintf("%d", unix))
+		filters.add(label, fmt.Sprintf("%d", unix))
 	default:
-		filters.Add(label, fmt.Sprintf("%v", v.Interface()))
+		filters.add(label, fmt.Sprintf("%v", v.Interface()))
 	}
 
 	return filters
 }
 
+// Clone returns a deep copy of filters.
+func (filters *Filters) Clone() *Filters {
+	clone := &Filters{
+		m:           make(indexesMap, len(filters.m)),
+		conds:       make([]condition, len(filters.conds)),
+		conf:        filters.conf,
+		maxPartials: filters.maxPartials,
+		selector:    filters.selector,
+		err:         filters.err,
+	}
+
+	for label, tokens := range filters.m {
+		clone.m[label] = make(map[string]struct{}, len(tokens))
+		for t := range tokens {
+			clone.m[label][t] = struct{}{}
+		}
+	}
+
+	copy(clone.conds, filters.conds)
+
+	if filters.fixed != nil {
+		clone.fixed = make(indexesMap, len(filters.fixed))
+		for label, tokens := range filters.fixed {
+			clone.fixed[label] = make(map[string]struct{}, len(tokens))
+			for t := range tokens {
+				clone.fixed[label][t] = struct{}{}
+			}
+		}
+	}
+
+	if filters.partials != nil {
+		clone.partials = make(map[string][]string, len(filters.partials))
+		for label, tokens := range filters.partials {
+			clone.partials[label] = append([]string(nil), tokens...)
+		}
+	}
+
+	return clone
+}
+
+// Alternatives returns a copy of filters for each value added with the label.
+// Equality filters of a list property express only AND conditions,
+// so that a query for any of values needs a query for each alternative.
+// Results of the queries should be merged.
+func (filters *Filters) Alternatives(label string, values ...string) []*Filters {
+	alts := make([]*Filters, 0, len(values))
+	for _, v := range values {
+		alts = append(alts, filters.Clone().Add(label, v))
+	}
+	return alts
+}
+
+// IncompleteLabels returns filtered labels whose indexes can be degraded by Config.BudgetPolicy.
+// Entities with degraded indexes can be missed by filters with such labels.
+// Query entities with IndexDegraded instead of the filters of the labels and verify them to find them.
+func (filters *Filters) IncompleteLabels() []string {
+	policy := filters.conf.BudgetPolicy
+	if policy == nil {
+		return nil
+	}
+
+	var labels []string
+	for label := range filters.m {
+		if policy.MayBeIncomplete(filters.conf, label) {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
 // Build builds indexes to save.
+// It returns the first error of operations rejected by Config.Schema.
 func (filters *Filters) Build() ([]string, error) {
+	if filters.err != nil {
+		return nil, filters.err
+	}
 
-	built := buildIndexes(filters.m, filters.conf.CompositeIdxLabels)
+	m := filters.filterMap()
 
+	var cis, covered []string
 	if len(filters.conf.CompositeIdxLabels) > 1 {
-		cis, err := createCompositeIndexes(filters.conf.CompositeIdxLabels, filters.m, true)
+		var err error
+		cis, covered, err = createCompositeFilters(filters.conf, m)
 		if err != nil {
 			return nil, err
 		}
-		built = append(built, cis...)
 	}
 
+	built := buildIndexes(filters.conf, m, covered)
+	built = append(built, cis...)
+
 	if filters.conf.SaveNoFiltersIndex && len(built) == 0 {
 		built = append(built, IndexNoFilters)
 	}
 
 	if len(built) > MaxIndexesSize {
-		return nil, errors.Errorf("index size exceeds %d", MaxIndexesSize)
+		return nil, newIndexSizeError(filters.conf, built, len(built))
 	}
 
 	return built, nil
@@ -151,7 +151,7 @@ func TestBuildFilter(t *testing.T) {
 	t.Run("ConfigのCompositeIdxLabelsがMaxCompositeIndexLabelsより大きい場合", func(t *testing.T) {
 		labels := make([]string, MaxCompositeIndexLabels+1)
 		for i := 0; i < len(labels); i++ {
-			labels[i] = string('a' + i)
+			labels[i] = string(rune('a' + i))
 		}
 
 		filter := NewFilters(&Config{CompositeIdxLabels: labels})
@@ -197,7 +197,7 @@ func TestMustBuildFilter(t *testing.T) {
 
 		labels := make([]string, MaxCompositeIndexLabels+1)
 		for i := 0; i < len(labels); i++ {
-			labels[i] = string('a' + i)
+			labels[i] = string(rune('a' + i))
 		}
 
 		filter := NewFilters(&Config{CompositeIdxLabels: labels})
@@ -327,3 +327,143 @@ func assertBuiltFilter(t *testing.T, actual, expected []string) {
 		t.Errorf("unexpected, actual: `%v`, expected: `%v`", actual, expected)
 	}
 }
+
+func TestFiltersAlternatives(t *testing.T) {
+	filters := NewFilters(&Config{IgnoreCase: true}).
+		Add("s", "1").
+		AddBiunigrams("ti", "abcd").
+		LimitPartialFilters(2, nil)
+
+	alts := filters.Alternatives("tg", "Go", "Rust")
+	if len(alts) != 2 {
+		t.Fatalf("len(alts) expected:%d, but was:%d", 2, len(alts))
+	}
+
+	assertBuiltFilter(t, alts[0].MustBuild(), []string{"s 1", "ti ab", "ti cd", "tg go"})
+	assertBuiltFilter(t, alts[1].MustBuild(), []string{"s 1", "ti ab", "ti cd", "tg rust"})
+
+	// the original is not changed.
+	assertBuiltFilter(t, filters.MustBuild(), []string{"s 1", "ti ab", "ti cd"})
+
+	assert(t, "Matcher", alts[1].Matcher().Match(Values{"ti": {"abxcd"}}), false)
+}
+
+func TestFilterConfigCompositeIdxMaxSize(t *testing.T) {
+	labels := make([]string, 12)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("l%d", i)
+	}
+
+	conf := MustValidateConfig(&Config{CompositeIdxLabels: labels, CompositeIdxMaxSize: 2})
+
+	filter := NewFilters(conf)
+	filter.Add("l0", "a")
+	filter.Add("l1", "b")
+	filter.Add("l5", "c")
+	filter.Add("l11", "d", "e")
+	filter.Add("l3", "f").Add("l4", "g")
+
+	built := filter.MustBuild()
+	assertBuiltIndex(t, built, []string{
+		"3 a;b",
+		fmt.Sprintf("%d f;g", 1<<3|1<<4),
+		fmt.Sprintf("%d c;d", 1<<5|1<<11),
+		fmt.Sprintf("%d c;e", 1<<5|1<<11),
+	})
+
+	idx := NewIndexes(conf)
+	idx.Add("l0", "a").Add("l1", "b").Add("l5", "c").Add("l11", "d", "e").Add("l3", "f").Add("l4", "g")
+	builtIndexes := idx.MustBuild()
+	for _, f := range built {
+		if !containsString(builtIndexes, f) {
+			t.Errorf("filter: %s not contains", f)
+		}
+	}
+
+	// a label left alone is filtered with a single label filter.
+	filter = NewFilters(conf).Add("l0", "a").Add("l1", "b").Add("l2", "c")
+	assertBuiltIndex(t, filter.MustBuild(), []string{"3 a;b", "l2 c"})
+}
+
+func TestFilterConfigCompositeIdxLabelsSingleLabel(t *testing.T) {
+	conf := &Config{CompositeIdxLabels: []string{"label1", "label2", "label3"}}
+
+	filter := NewFilters(conf).Add("label2", "b").Add("label4", "d")
+	built := filter.MustBuild()
+	assertBuiltIndex(t, built, []string{"label2 b", "label4 d"})
+
+	idx := NewIndexes(conf).Add("label1", "a").Add("label2", "b").Add("label4", "d").MustBuild()
+	for _, f := range built {
+		if !containsString(idx, f) {
+			t.Errorf("filter: %s not contains", f)
+		}
+	}
+}
+
+func TestFilterConfigCompositeIdxCombinations(t *testing.T) {
+	conf := MustValidateConfig(&Config{
+		CompositeIdxLabels: []string{"s", "c", "p", "h", "t"},
+		CompositeIdxCombinations: [][]string{
+			{"c", "s"},
+			{"s", "c", "p"},
+			{"p", "h"},
+			{"h", "t"},
+		},
+	})
+
+	for _, tc := range []struct {
+		name     string
+		filters  *Filters
+		expected []string
+	}{
+		{
+			"最も多くのラベルを持つ組み合わせ",
+			NewFilters(conf).Add("s", "1").Add("c", "sports").Add("p", "p<3000").Add("h", "true"),
+			[]string{"7 1;sports;p<3000", "h true"},
+		},
+		{
+			"重複しない組み合わせ",
+			NewFilters(conf).Add("s", "1").Add("c", "sports").Add("h", "true").Add("t", "x"),
+			[]string{"3 1;sports", "24 true;x"},
+		},
+		{
+			"組み合わせがない場合",
+			NewFilters(conf).Add("s", "1").Add("p", "p<3000"),
+			[]string{"s 1", "p p<3000"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			built := tc.filters.MustBuild()
+			assertBuiltIndex(t, built, tc.expected)
+
+			idx := NewIndexes(conf)
+			for label, tokens := range tc.filters.m {
+				for token := range tokens {
+					idx.Add(label, token)
+				}
+			}
+			builtIndexes := idx.MustBuild()
+			for _, f := range built {
+				if !containsString(builtIndexes, f) {
+					t.Errorf("filter: %s not contains", f)
+				}
+			}
+		})
+	}
+}
+
+func TestFiltersIncompleteLabels(t *testing.T) {
+	conf := &Config{
+		CompositeIdxLabels: []string{"s", "c"},
+		BudgetPolicy: &BudgetPolicy{
+			Strategies: []BudgetStrategy{DropCompositeIndexes, DropLongestTokens},
+			Priorities: map[string]int{"tp": 1},
+		},
+	}
+
+	filters := NewFilters(conf).Add("s", "1").AddPrefix("tp", "abc").Add("h", "true")
+	assert(t, "IncompleteLabels", fmt.Sprint(filters.IncompleteLabels()), "[s tp]")
+
+	filters = NewFilters(nil).AddPrefix("tp", "abc")
+	assert(t, "no policy", len(filters.IncompleteLabels()), 0)
+}
@@ -0,0 +1,107 @@
+package xian
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IndexFormatVersion is the version of tokens created by this package.
+// It's incremented when tokenizers change tokens.
+const IndexFormatVersion = 1
+
+// IndexFingerprintPrefix is the prefix of the fingerprint index saved with Config.SaveFingerprintIndex.
+// The index is like "__Fingerprint__:1:0123456789abcdef" where 1 is IndexFormatVersion.
+const IndexFingerprintPrefix = "__Fingerprint__" + fingerprintSeparator
+
+const fingerprintSeparator = ":"
+
+// Errors reported by Config.CheckFingerprint.
+var (
+	ErrNoFingerprint        = errors.New("no fingerprint index")
+	ErrFingerprintMismatch  = errors.New("fingerprint mismatch")
+	ErrIndexVersionMismatch = errors.New("index format version mismatch")
+)
+
+// fingerprintSource is the configuration which changes tokens.
+type fingerprintSource struct {
+	IgnoreCase               bool       `json:"ignoreCase"`
+	EscapeSeparators         bool       `json:"escapeSeparators,omitempty"`
+	CompositeIdxLabels       []string   `json:"compositeIdxLabels"`
+	CompositeIdxMaxSize      int        `json:"compositeIdxMaxSize"`
+	CompositeIdxCombinations [][]string `json:"compositeIdxCombinations"`
+	Schema                   *Schema    `json:"schema"`
+}
+
+// Fingerprint returns a digest of the configuration which changes tokens,
+// i.e. IgnoreCase, EscapeSeparators, composite index settings and Schema.
+func (conf *Config) Fingerprint() string {
+	// hash composite labels resolved from Schema like indexes are built with.
+	conf = conf.withSchemaComposites()
+	b, err := json.Marshal(&fingerprintSource{
+		IgnoreCase:               conf.IgnoreCase,
+		EscapeSeparators:         conf.EscapeSeparators,
+		CompositeIdxLabels:       conf.CompositeIdxLabels,
+		CompositeIdxMaxSize:      conf.CompositeIdxMaxSize,
+		CompositeIdxCombinations: conf.CompositeIdxCombinations,
+		Schema:                   conf.Schema,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// FingerprintIndex returns the fingerprint index of the configuration.
+// Entities saved with another configuration can be found by querying with old fingerprint indexes.
+func (conf *Config) FingerprintIndex() string {
+	return fmt.Sprintf("%s%d%s%s", IndexFingerprintPrefix, IndexFormatVersion, fingerprintSeparator, conf.Fingerprint())
+}
+
+// ParseFingerprintIndex returns the index format version and the fingerprint of the fingerprint index in indexes.
+// ok is false if indexes have no fingerprint index.
+func ParseFingerprintIndex(indexes []string) (version int, fingerprint string, ok bool, err error) {
+	for _, idx := range indexes {
+		if !strings.HasPrefix(idx, IndexFingerprintPrefix) {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(idx, IndexFingerprintPrefix), fingerprintSeparator, 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return 0, "", false, errors.Errorf("invalid fingerprint index %q", idx)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return 0, "", false, errors.Errorf("invalid fingerprint index %q", idx)
+		}
+		return version, parts[1], true, nil
+	}
+	return 0, "", false, nil
+}
+
+// CheckFingerprint checks whether indexes were built with the configuration and the current IndexFormatVersion.
+// It returns an error caused by ErrNoFingerprint, ErrIndexVersionMismatch or ErrFingerprintMismatch
+// if the entity needs reindexing.
+func (conf *Config) CheckFingerprint(indexes []string) error {
+	version, fingerprint, ok, err := ParseFingerprintIndex(indexes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoFingerprint
+	}
+	if version != IndexFormatVersion {
+		return errors.Wrapf(ErrIndexVersionMismatch, "saved %d, current %d", version, IndexFormatVersion)
+	}
+	if current := conf.Fingerprint(); fingerprint != current {
+		return errors.Wrapf(ErrFingerprintMismatch, "saved %s, current %s", fingerprint, current)
+	}
+	return nil
+}
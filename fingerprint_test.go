@@ -0,0 +1,104 @@
+package xian
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFingerprint(t *testing.T) {
+	base := func() *Config {
+		return &Config{
+			CompositeIdxLabels: []string{"s", "c"},
+			Schema: MustNewSchema(
+				&LabelSchema{Name: "s", Kind: LabelExact, Composite: true},
+				&LabelSchema{Name: "c", Kind: LabelExact, Composite: true},
+				&LabelSchema{Name: "ti", Kind: LabelPartial},
+			),
+		}
+	}
+
+	fp := base().Fingerprint()
+	assert(t, "same config", base().Fingerprint(), fp)
+	assert(t, "len", len(fp), 16)
+
+	withBudget := base()
+	withBudget.SaveNoFiltersIndex = true
+	withBudget.BudgetPolicy = &BudgetPolicy{Strategies: []BudgetStrategy{DropCompositeIndexes}}
+	assert(t, "options not changing tokens", withBudget.Fingerprint(), fp)
+
+	for _, tc := range []struct {
+		name   string
+		modify func(conf *Config)
+	}{
+		{"IgnoreCase", func(conf *Config) { conf.IgnoreCase = true }},
+		{"CompositeIdxLabelsの順序", func(conf *Config) { conf.CompositeIdxLabels = []string{"c", "s"} }},
+		{"CompositeIdxMaxSize", func(conf *Config) { conf.CompositeIdxMaxSize = 2 }},
+		{"CompositeIdxCombinations", func(conf *Config) { conf.CompositeIdxCombinations = [][]string{{"s", "c"}} }},
+		{"Schema", func(conf *Config) {
+			conf.Schema = MustNewSchema(append(conf.Schema.Labels(), &LabelSchema{Name: "tp", Kind: LabelPrefix})...)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := base()
+			tc.modify(conf)
+			if conf.Fingerprint() == fp {
+				t.Errorf("fingerprint %s not changed", fp)
+			}
+		})
+	}
+}
+
+func TestCheckFingerprint(t *testing.T) {
+	conf := &Config{SaveFingerprintIndex: true}
+
+	built := NewIndexes(conf).Add("s", "1").MustBuild()
+	assert(t, "fingerprint index", containsString(built, conf.FingerprintIndex()), true)
+	if err := conf.CheckFingerprint(built); err != nil {
+		t.Errorf("error = %s, wants = nil", err)
+	}
+
+	version, fp, ok, err := ParseFingerprintIndex(built)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, "ok", ok, true)
+	assert(t, "version", version, IndexFormatVersion)
+	assert(t, "fingerprint", fp, conf.Fingerprint())
+
+	t.Run("集計に含まれない", func(t *testing.T) {
+		stats := NewStats(conf)
+		stats.Add(built)
+		assert(t, "len(Frequencies)", len(stats.Frequencies), 1)
+	})
+
+	for _, tc := range []struct {
+		name    string
+		indexes []string
+		err     error
+	}{
+		{"フィンガープリントがない場合", NewIndexes(nil).Add("s", "1").MustBuild(), ErrNoFingerprint},
+		{"設定が異なる場合", NewIndexes(&Config{SaveFingerprintIndex: true, IgnoreCase: true}).MustBuild(), ErrFingerprintMismatch},
+		{"バージョンが異なる場合", []string{IndexFingerprintPrefix + "0:" + conf.Fingerprint()}, ErrIndexVersionMismatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := conf.CheckFingerprint(tc.indexes); errors.Cause(err) != tc.err {
+				t.Errorf("err expected:%v, but was:%v", tc.err, err)
+			}
+		})
+	}
+
+	t.Run("Schemaで宣言した複合インデックス", func(t *testing.T) {
+		conf := &Config{Schema: newTestSchema(), SaveFingerprintIndex: true}
+		built := NewIndexes(conf).Add("s", "1").Add("c", "2").MustBuild()
+		if err := conf.CheckFingerprint(built); err != nil {
+			t.Errorf("error = %s, wants = nil", err)
+		}
+	})
+
+	t.Run("不正な形式", func(t *testing.T) {
+		if err := conf.CheckFingerprint([]string{IndexFingerprintPrefix + "x"}); err == nil {
+			t.Error("error = nil, wants != nil")
+		}
+	})
+}
@@ -2,4 +2,7 @@ module github.com/knightso/xian
 
 go 1.11
 
-require github.com/pkg/errors v0.9.1
+require (
+	github.com/pkg/errors v0.9.1
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -1,54 +1,366 @@
 package xian
 
-import "fmt"
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
 
-// Bit describes In-Filter mask bit
-type Bit uint16
+	"github.com/pkg/errors"
+)
 
-// InBuilder creates Bit for In-Filter
+const (
+	// InGroupSize is the default and maximum number of bits in a group of InBuilder.
+	InGroupSize = 16
+	// CompactInGroupSize is a group size which keeps the number of indexes small.
+	CompactInGroupSize = 4
+)
+
+// maxInGroup is the maximum group number encoded in the upper 16 bits of Bit.
+const maxInGroup = 0xFFFF
+
+const (
+	inGroupSeparator = ":"
+	inNonePrefix     = "!"
+)
+
+// Bit describes In-Filter mask bit.
+// The lower 16 bits are the mask in the group and the upper bits are the group number.
+// Bits of the first group are the same as plain mask bits.
+type Bit uint32
+
+func (b Bit) group() int {
+	return int(b >> 16)
+}
+
+func (b Bit) mask() uint16 {
+	return uint16(b)
+}
+
+// InConfig describes InBuilder configuration.
+type InConfig struct {
+	// GroupSize is the number of bits in a group. InGroupSize is used if it's zero.
+	//
+	// Indexes creates every combination of bits in each group intersecting with the bits,
+	// i.e. up to 2^(GroupSize-1) indexes for each group.
+	// Smaller size such as CompactInGroupSize reduces indexes
+	// while a set of bits is more likely to span groups and need more queries.
+	GroupSize int
+	// SaveNoneIndexes defines whether to save indexes for ContainsNone.
+	// Indexes creates every combination of bits in each group disjoint from the bits in addition,
+	// so that it should be used with small GroupSize.
+	// Indexes created before adding bits don't match ContainsNone with the new bits.
+	SaveNoneIndexes bool
+}
+
+// InBuilder creates Bit for In-Filter.
+//
+// Bits are partitioned into groups of InConfig.GroupSize bits.
+// Indexes and filters of the first group are hexadecimal masks and
+// those of the following groups are qualified with the group number like "1:a".
+// A filter can't combine bits of different groups,
+// so that a set of bits spanning groups needs a query for each group.
 type InBuilder struct {
-	nextBit Bit
+	groupSize int
+	saveNone  bool
+	size      int            // number of positions up to the last allocated bit
+	positions map[int]string // key=allocated position, value=name
+	names     map[string]int // key=name, value=position
 }
 
 // NewInBuilder creates InBuilder
 func NewInBuilder() *InBuilder {
-	return &InBuilder{nextBit: 1}
+	return NewInBuilderWithConfig(nil)
+}
+
+// NewInBuilderWithConfig creates InBuilder with conf.
+// It panics if conf.GroupSize is out of range.
+func NewInBuilderWithConfig(conf *InConfig) *InBuilder {
+	groupSize := InGroupSize
+	if conf != nil && conf.GroupSize != 0 {
+		groupSize = conf.GroupSize
+	}
+	if groupSize < 1 || groupSize > InGroupSize {
+		panic(fmt.Sprintf("GroupSize must be between 1 and %d", InGroupSize))
+	}
+
+	return &InBuilder{
+		groupSize: groupSize,
+		saveNone:  conf != nil && conf.SaveNoneIndexes,
+		positions: make(map[int]string),
+		names:     make(map[string]int),
+	}
+}
+
+func (f *InBuilder) init() {
+	if f.groupSize == 0 {
+		f.groupSize = InGroupSize
+	}
+	if f.positions == nil {
+		f.positions = make(map[int]string)
+		f.names = make(map[string]int)
+	}
 }
 
 // NewBit returns a new bit shifted.
+// The bit is placed next to the last allocated bit.
+// It panics if the bit exceeds the last group.
 func (f *InBuilder) NewBit() Bit {
-	if f.nextBit == 0 {
-		panic("overflow")
+	f.init()
+
+	pos := f.size
+	if pos/f.groupSize > maxInGroup {
+		panic(fmt.Sprintf("position %d exceeds group %d", pos, maxInGroup))
+	}
+	f.positions[pos] = ""
+	f.size++
+	return f.newBit(pos)
+}
+
+// NewBitNamed returns the bit at the explicit position pos with name.
+// Positions are stable regardless of the declaration order unlike NewBit.
+// It returns the same bit if name is already at pos, and an error if name is
+// at another position or pos is already allocated to another bit.
+func (f *InBuilder) NewBitNamed(name string, pos int) (Bit, error) {
+	f.init()
+
+	if name == "" {
+		return 0, errors.New("empty name")
+	}
+	if pos < 0 {
+		return 0, errors.Errorf("negative position %d for %q", pos, name)
+	}
+	if pos/f.groupSize > maxInGroup {
+		return 0, errors.Errorf("position %d for %q exceeds group %d", pos, name, maxInGroup)
+	}
+
+	if p, ok := f.names[name]; ok {
+		if p != pos {
+			return 0, errors.Errorf("%q is already at position %d, can't reassign to %d", name, p, pos)
+		}
+		return f.newBit(pos), nil
 	}
 
-	bit := f.nextBit
-	f.nextBit <<= 1
+	if n, ok := f.positions[pos]; ok {
+		if n == "" {
+			return 0, errors.Errorf("position %d for %q is already allocated", pos, name)
+		}
+		return 0, errors.Errorf("position %d for %q is already allocated to %q", pos, name, n)
+	}
+
+	f.positions[pos] = name
+	f.names[name] = pos
+	if pos >= f.size {
+		f.size = pos + 1
+	}
+
+	return f.newBit(pos), nil
+}
 
+// MustNewBitNamed is like NewBitNamed but panics with error.
+func (f *InBuilder) MustNewBitNamed(name string, pos int) Bit {
+	bit, err := f.NewBitNamed(name, pos)
+	if err != nil {
+		panic(err)
+	}
 	return bit
 }
 
+// Bit returns the bit with name.
+func (f *InBuilder) Bit(name string) (Bit, bool) {
+	pos, ok := f.names[name]
+	if !ok {
+		return 0, false
+	}
+	return f.newBit(pos), true
+}
+
+// Name returns the name of bit.
+func (f *InBuilder) Name(bit Bit) (string, bool) {
+	name, ok := f.positions[f.position(bit)]
+	if !ok || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// NamedBits returns all the named bits.
+func (f *InBuilder) NamedBits() map[string]Bit {
+	bits := make(map[string]Bit, len(f.names))
+	for name, pos := range f.names {
+		bits[name] = f.newBit(pos)
+	}
+	return bits
+}
+
+func (f *InBuilder) newBit(pos int) Bit {
+	return Bit(pos/f.groupSize)<<16 | Bit(1)<<uint(pos%f.groupSize)
+}
+
+// position returns the position of a single bit.
+func (f *InBuilder) position(bit Bit) int {
+	return bit.group()*f.groupSize + bits.TrailingZeros16(bit.mask())
+}
+
+// groupWidth returns the number of allocated bits in group g.
+func (f *InBuilder) groupWidth(g int) int {
+	w := f.size - g*f.groupSize
+	switch {
+	case w > f.groupSize:
+		return f.groupSize
+	case w < 0:
+		return 0
+	}
+	return w
+}
+
+func (f *InBuilder) token(g int, mask uint16) string {
+	if g == 0 {
+		return fmt.Sprintf("%x", mask)
+	}
+	return fmt.Sprintf("%d%s%x", g, inGroupSeparator, mask)
+}
+
 // Indexes creates indexes for In-Filter with multi-bits
 func (f *InBuilder) Indexes(bits ...Bit) (indexes []string) {
-	allBits := f.combineBits(bits...)
+	groups, masks := f.combineBits(bits...)
+
+	for i, g := range groups {
+		max := uint32(1)<<uint(f.groupWidth(g)) - 1
+		for m := uint32(1); m <= max; m++ {
+			if uint16(m)&masks[i] != 0 {
+				indexes = append(indexes, f.token(g, uint16(m)))
+			}
+		}
+	}
+
+	if f.saveNone {
+		indexes = append(indexes, f.noneIndexes(groups, masks)...)
+	}
+
+	return indexes
+}
+
+// noneIndexes creates indexes of every combination disjoint from masks for all groups.
+func (f *InBuilder) noneIndexes(groups []int, masks []uint16) (indexes []string) {
+	groupMasks := make(map[int]uint16, len(groups))
+	for i, g := range groups {
+		groupMasks[g] = masks[i]
+	}
 
-	for i := Bit(1); i <= f.nextBit-1; i++ {
-		if i&allBits != 0 {
-			indexes = append(indexes, fmt.Sprintf("%x", i))
+	for g := 0; g*f.groupSize < f.size; g++ {
+		max := uint32(1)<<uint(f.groupWidth(g)) - 1
+		for m := uint32(1); m <= max; m++ {
+			if uint16(m)&groupMasks[g] == 0 {
+				indexes = append(indexes, inNonePrefix+f.token(g, uint16(m)))
+			}
 		}
 	}
 
 	return indexes
 }
 
-// Indexes creates indexes for In-Filter
+// ContainsAll creates filters to search entities with all the bits.
+// All the filters should be added to a query.
+func (f *InBuilder) ContainsAll(bits ...Bit) []string {
+	filters := make([]string, 0, len(bits))
+	for _, bit := range bits {
+		filter := f.token(bit.group(), bit.mask())
+		if !containsToken(filters, filter) {
+			filters = append(filters, filter)
+		}
+	}
+	return filters
+}
+
+// ContainsNone creates filters to search entities with none of the bits.
+// All the filters should be added to a query.
+// It panics if InConfig.SaveNoneIndexes is false.
+func (f *InBuilder) ContainsNone(bits ...Bit) []string {
+	if !f.saveNone {
+		panic("ContainsNone requires InConfig.SaveNoneIndexes")
+	}
+
+	groups, masks := f.combineBits(bits...)
+
+	filters := make([]string, 0, len(groups))
+	for i, g := range groups {
+		filters = append(filters, inNonePrefix+f.token(g, masks[i]))
+	}
+
+	return filters
+}
+
+// Filter creates a filter for In-Filter.
+// It panics if bits span multiple groups. Use FilterSets for such bits.
 func (f *InBuilder) Filter(bits ...Bit) string {
-	allBits := f.combineBits(bits...)
-	return fmt.Sprintf("%x", allBits)
+	groups, masks := f.combineBits(bits...)
+	switch len(groups) {
+	case 0:
+		return f.token(0, 0)
+	case 1:
+		return f.token(groups[0], masks[0])
+	default:
+		panic("bits span multiple groups")
+	}
+}
+
+// FilterSets creates alternative filters for In-Filter, one for each group of bits.
+// Each filter needs its own query and the results should be merged.
+func (f *InBuilder) FilterSets(bits ...Bit) []string {
+	groups, masks := f.combineBits(bits...)
+
+	filters := make([]string, 0, len(groups))
+	for i, g := range groups {
+		filters = append(filters, f.token(g, masks[i]))
+	}
+
+	return filters
 }
 
-func (f *InBuilder) combineBits(bits ...Bit) (allBits Bit) {
+// combineBits combines bits for each group. groups are sorted.
+func (f *InBuilder) combineBits(bits ...Bit) (groups []int, masks []uint16) {
+	m := make(map[int]uint16)
 	for _, bit := range bits {
-		allBits |= bit
+		m[bit.group()] |= bit.mask()
+	}
+
+	for g := range m {
+		groups = append(groups, g)
+	}
+	sort.Ints(groups)
+
+	for _, g := range groups {
+		masks = append(masks, m[g])
+	}
+
+	return groups, masks
+}
+
+// Decode returns bits from index tokens created by Indexes.
+// Tokens of combined bits are ignored.
+func (f *InBuilder) Decode(tokens []string) (bits []Bit) {
+	for _, t := range tokens {
+		g := 0
+		if i := strings.Index(t, inGroupSeparator); i >= 0 {
+			v, err := strconv.Atoi(t[:i])
+			if err != nil || v <= 0 {
+				continue
+			}
+			g, t = v, t[i+len(inGroupSeparator):]
+		}
+
+		v, err := strconv.ParseUint(t, 16, 16)
+		if err != nil {
+			continue
+		}
+		mask := uint16(v)
+		if mask == 0 || mask&(mask-1) != 0 || uint32(mask) >= uint32(1)<<uint(f.groupWidth(g)) {
+			continue
+		}
+		bits = append(bits, Bit(g)<<16|Bit(mask))
 	}
-	return allBits
+	sort.Slice(bits, func(i, j int) bool { return bits[i] < bits[j] })
+	return bits
 }
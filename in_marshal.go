@@ -0,0 +1,242 @@
+package xian
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// inBuilderState is a serialized form of InBuilder.
+type inBuilderState struct {
+	GroupSize int            `json:"groupSize"`
+	SaveNone  bool           `json:"saveNoneIndexes,omitempty"`
+	Bits      map[string]int `json:"bits"`                // key=name, value=position
+	Anonymous []int          `json:"anonymous,omitempty"` // positions of bits without names
+}
+
+func (f *InBuilder) state() *inBuilderState {
+	f.init()
+
+	st := &inBuilderState{
+		GroupSize: f.groupSize,
+		SaveNone:  f.saveNone,
+		Bits:      make(map[string]int, len(f.names)),
+	}
+	for pos, name := range f.positions {
+		if name == "" {
+			st.Anonymous = append(st.Anonymous, pos)
+		} else {
+			st.Bits[name] = pos
+		}
+	}
+	sort.Ints(st.Anonymous)
+
+	return st
+}
+
+func (f *InBuilder) restore(st *inBuilderState) error {
+	if st.GroupSize < 1 || st.GroupSize > InGroupSize {
+		return errors.Errorf("invalid group size %d", st.GroupSize)
+	}
+
+	restored := NewInBuilderWithConfig(&InConfig{
+		GroupSize:       st.GroupSize,
+		SaveNoneIndexes: st.SaveNone,
+	})
+	for name, pos := range st.Bits {
+		if _, err := restored.NewBitNamed(name, pos); err != nil {
+			return err
+		}
+	}
+	for _, pos := range st.Anonymous {
+		if pos < 0 {
+			return errors.Errorf("negative position %d", pos)
+		}
+		if pos/restored.groupSize > maxInGroup {
+			return errors.Errorf("position %d exceeds group %d", pos, maxInGroup)
+		}
+		if _, ok := restored.positions[pos]; ok {
+			return errors.Errorf("position %d is already allocated", pos)
+		}
+		restored.positions[pos] = ""
+		if pos >= restored.size {
+			restored.size = pos + 1
+		}
+	}
+
+	*f = *restored
+	return nil
+}
+
+// MarshalJSON encodes the assignment of bits.
+func (f *InBuilder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.state())
+}
+
+// UnmarshalJSON restores the assignment of bits encoded by MarshalJSON.
+func (f *InBuilder) UnmarshalJSON(b []byte) error {
+	var st inBuilderState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return err
+	}
+	return f.restore(&st)
+}
+
+const (
+	inGroupSizeHeader = "group-size"
+	inSaveNoneHeader  = "save-none-indexes"
+)
+
+// MarshalText encodes the assignment of bits as lines of a position and a quoted name.
+//
+//	group-size 16
+//	save-none-indexes
+//	0 "unpublished"
+//	1 "published"
+//	2
+func (f *InBuilder) MarshalText() ([]byte, error) {
+	st := f.state()
+
+	positions := make([]int, 0, len(st.Bits)+len(st.Anonymous))
+	names := make(map[int]string, len(st.Bits))
+	for name, pos := range st.Bits {
+		positions = append(positions, pos)
+		names[pos] = name
+	}
+	positions = append(positions, st.Anonymous...)
+	sort.Ints(positions)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %d\n", inGroupSizeHeader, st.GroupSize)
+	if st.SaveNone {
+		fmt.Fprintf(&buf, "%s\n", inSaveNoneHeader)
+	}
+	for _, pos := range positions {
+		if name, ok := names[pos]; ok {
+			fmt.Fprintf(&buf, "%d %s\n", pos, strconv.Quote(name))
+		} else {
+			fmt.Fprintf(&buf, "%d\n", pos)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText restores the assignment of bits encoded by MarshalText.
+func (f *InBuilder) UnmarshalText(text []byte) error {
+	st := &inBuilderState{
+		GroupSize: InGroupSize,
+		Bits:      make(map[string]int),
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if line == inSaveNoneHeader {
+			st.SaveNone = true
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+
+		if fields[0] == inGroupSizeHeader && len(fields) == 2 {
+			size, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return errors.Wrapf(err, "line %d", n)
+			}
+			st.GroupSize = size
+			continue
+		}
+
+		pos, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return errors.Wrapf(err, "line %d", n)
+		}
+
+		if len(fields) == 1 {
+			st.Anonymous = append(st.Anonymous, pos)
+			continue
+		}
+
+		name, err := strconv.Unquote(fields[1])
+		if err != nil {
+			return errors.Wrapf(err, "line %d", n)
+		}
+		if _, ok := st.Bits[name]; ok {
+			return errors.Errorf("line %d: duplicated name %q", n, name)
+		}
+		st.Bits[name] = pos
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return f.restore(st)
+}
+
+// CheckCompatible checks whether indexes created by prev are still valid with f.
+// f must have the same group size and every bit of prev at the same position with the same name.
+// New bits must be within the width of groups of prev or in new groups,
+// since widening a group changes masks of the group.
+// f can't save none indexes if prev didn't, and new groups are not allowed with none indexes
+// since indexes created by prev lack none indexes of them.
+// Use it at startup with the state saved by a previous version to detect incompatible changes.
+func (f *InBuilder) CheckCompatible(prev *InBuilder) error {
+	cur, old := f.state(), prev.state()
+
+	var problems []string
+
+	if cur.GroupSize != old.GroupSize {
+		problems = append(problems, fmt.Sprintf("group size changed from %d to %d", old.GroupSize, cur.GroupSize))
+	} else {
+		// indexes of a group are combinations of its width, so that
+		// entities indexed with the narrower group lack masks with the new bits.
+		g := 0
+		for ; g*prev.groupSize < prev.size; g++ {
+			if w, pw := f.groupWidth(g), prev.groupWidth(g); w > pw {
+				problems = append(problems, fmt.Sprintf("group %d is widened from %d to %d bits", g, pw, w))
+			}
+		}
+		if cur.SaveNone || old.SaveNone {
+			for ; g*f.groupSize < f.size; g++ {
+				problems = append(problems, fmt.Sprintf("group %d is added with none indexes", g))
+			}
+		}
+	}
+	if cur.SaveNone && !old.SaveNone {
+		problems = append(problems, "none indexes are not saved")
+	}
+
+	for name, pos := range old.Bits {
+		p, ok := cur.Bits[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%q at position %d is removed", name, pos))
+		case p != pos:
+			problems = append(problems, fmt.Sprintf("%q is moved from position %d to %d", name, pos, p))
+		}
+	}
+
+	for _, pos := range old.Anonymous {
+		if _, ok := f.positions[pos]; !ok {
+			problems = append(problems, fmt.Sprintf("bit at position %d is removed", pos))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.Errorf("incompatible InBuilder: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package xian
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestInBuilder() *InBuilder {
+	inBuilder := NewInBuilderWithConfig(&InConfig{GroupSize: CompactInGroupSize})
+	inBuilder.MustNewBitNamed("unpublished", 0)
+	inBuilder.MustNewBitNamed("published", 1)
+	inBuilder.NewBit()
+	inBuilder.MustNewBitNamed("say \"hello\"", 5)
+	return inBuilder
+}
+
+func TestInBuilderMarshalJSON(t *testing.T) {
+	inBuilder := newTestInBuilder()
+
+	b, err := json.Marshal(inBuilder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"groupSize":4,"bits":{"published":1,"say \"hello\"":5,"unpublished":0},"anonymous":[2]}`
+	if string(b) != expected {
+		t.Errorf("unexpected, actual: `%s`, expected: `%s`", b, expected)
+	}
+
+	restored := NewInBuilder()
+	if err := json.Unmarshal(b, restored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, inBuilder) {
+		t.Errorf("unexpected, actual: `%#v`, expected: `%#v`", restored, inBuilder)
+	}
+
+	for _, s := range []string{
+		`{"groupSize":0,"bits":{}}`,
+		`{"groupSize":4,"bits":{"a":1,"b":1}}`,
+		`{"groupSize":4,"bits":{"a":1},"anonymous":[1]}`,
+		`{"groupSize":4,"bits":{},"anonymous":[-1]}`,
+	} {
+		if err := json.Unmarshal([]byte(s), NewInBuilder()); err == nil {
+			t.Errorf("%s: error = nil, wants != nil", s)
+		}
+	}
+}
+
+func TestInBuilderMarshalText(t *testing.T) {
+	inBuilder := newTestInBuilder()
+
+	text, err := inBuilder.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		`group-size 4`,
+		`0 "unpublished"`,
+		`1 "published"`,
+		`2`,
+		`5 "say \"hello\""`,
+		``,
+	}, "\n")
+	if string(text) != expected {
+		t.Errorf("unexpected, actual: `%s`, expected: `%s`", text, expected)
+	}
+
+	restored := NewInBuilder()
+	if err := restored.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, inBuilder) {
+		t.Errorf("unexpected, actual: `%#v`, expected: `%#v`", restored, inBuilder)
+	}
+
+	for _, s := range []string{
+		"group-size x",
+		"x \"a\"",
+		"0 a",
+		"0 \"a\"\n1 \"a\"",
+		"group-size 17",
+	} {
+		if err := NewInBuilder().UnmarshalText([]byte(s)); err == nil {
+			t.Errorf("%q: error = nil, wants != nil", s)
+		}
+	}
+}
+
+func TestInBuilderCheckCompatible(t *testing.T) {
+	prev := newTestInBuilder()
+
+	t.Run("互換性がある場合", func(t *testing.T) {
+		cur := newTestInBuilder()
+		cur.MustNewBitNamed("discontinued", 3)
+		if err := cur.CheckCompatible(prev); err != nil {
+			t.Errorf("error = %v, wants = nil", err)
+		}
+	})
+
+	t.Run("新しいグループに追加した場合", func(t *testing.T) {
+		prev := NewInBuilderWithConfig(&InConfig{GroupSize: 2})
+		prev.MustNewBitNamed("a", 0)
+		prev.MustNewBitNamed("b", 1)
+
+		cur := NewInBuilderWithConfig(&InConfig{GroupSize: 2})
+		cur.MustNewBitNamed("a", 0)
+		cur.MustNewBitNamed("b", 1)
+		cur.MustNewBitNamed("c", 2)
+		if err := cur.CheckCompatible(prev); err != nil {
+			t.Errorf("error = %v, wants = nil", err)
+		}
+	})
+
+	for name, cur := range map[string]*InBuilder{
+		"GroupSizeが異なる場合": func() *InBuilder {
+			cur := NewInBuilder()
+			cur.MustNewBitNamed("unpublished", 0)
+			cur.MustNewBitNamed("published", 1)
+			cur.NewBit()
+			cur.MustNewBitNamed("say \"hello\"", 5)
+			return cur
+		}(),
+		"位置が異なる場合": func() *InBuilder {
+			cur := NewInBuilderWithConfig(&InConfig{GroupSize: CompactInGroupSize})
+			cur.MustNewBitNamed("published", 0)
+			cur.MustNewBitNamed("unpublished", 1)
+			cur.NewBit()
+			cur.MustNewBitNamed("say \"hello\"", 5)
+			return cur
+		}(),
+		"グループが広がった場合": func() *InBuilder {
+			cur := newTestInBuilder()
+			cur.NewBit()
+			return cur
+		}(),
+		"削除された場合": func() *InBuilder {
+			cur := NewInBuilderWithConfig(&InConfig{GroupSize: CompactInGroupSize})
+			cur.MustNewBitNamed("unpublished", 0)
+			cur.MustNewBitNamed("published", 1)
+			return cur
+		}(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := cur.CheckCompatible(prev); err == nil {
+				t.Error("error = nil, wants != nil")
+			}
+		})
+	}
+}
+
+func TestInBuilderCheckCompatibleWidenedGroup(t *testing.T) {
+	prev := NewInBuilderWithConfig(&InConfig{GroupSize: CompactInGroupSize})
+	a := prev.MustNewBitNamed("a", 0)
+	prev.MustNewBitNamed("b", 1)
+
+	// saved with the old state
+	saved := prev.Indexes(a)
+
+	cur := NewInBuilderWithConfig(&InConfig{GroupSize: CompactInGroupSize})
+	cur.MustNewBitNamed("a", 0)
+	cur.MustNewBitNamed("b", 1)
+	c := cur.MustNewBitNamed("c", 2)
+
+	assert(t, "filter with the widened group", containsString(saved, cur.Filter(a, c)), false)
+	if err := cur.CheckCompatible(prev); err == nil {
+		t.Error("error = nil, wants != nil")
+	}
+}
+
+func TestInBuilderCheckCompatibleSaveNoneIndexes(t *testing.T) {
+	conf := &InConfig{GroupSize: 4, SaveNoneIndexes: true}
+
+	prev := NewInBuilderWithConfig(conf)
+	first := prev.NewBit()
+	for i := 0; i < 3; i++ {
+		prev.NewBit()
+	}
+
+	t.Run("グループが追加された場合", func(t *testing.T) {
+		cur := NewInBuilderWithConfig(conf)
+		var last Bit
+		for i := 0; i < 5; i++ {
+			last = cur.NewBit()
+		}
+
+		// saved with the old state
+		saved := prev.Indexes(first)
+
+		assert(t, "none filter of the new group", containsString(saved, cur.ContainsNone(last)[0]), false)
+		if err := cur.CheckCompatible(prev); err == nil {
+			t.Error("error = nil, wants != nil")
+		}
+	})
+
+	t.Run("グループが広がった場合", func(t *testing.T) {
+		prev := NewInBuilderWithConfig(conf)
+		prev.NewBit()
+
+		cur := NewInBuilderWithConfig(conf)
+		cur.NewBit()
+		cur.NewBit()
+		if err := cur.CheckCompatible(prev); err == nil {
+			t.Error("error = nil, wants != nil")
+		}
+	})
+}
+
+func TestInBuilderMarshalSaveNoneIndexes(t *testing.T) {
+	inBuilder := NewInBuilderWithConfig(&InConfig{GroupSize: 2, SaveNoneIndexes: true})
+	inBuilder.MustNewBitNamed("a", 0)
+
+	text, err := inBuilder.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "group-size 2\nsave-none-indexes\n0 \"a\"\n"; string(text) != expected {
+		t.Errorf("unexpected, actual: `%s`, expected: `%s`", text, expected)
+	}
+
+	restored := NewInBuilder()
+	if err := restored.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, inBuilder) {
+		t.Errorf("unexpected, actual: `%#v`, expected: `%#v`", restored, inBuilder)
+	}
+
+	prev := NewInBuilderWithConfig(&InConfig{GroupSize: 2})
+	prev.MustNewBitNamed("a", 0)
+	if err := inBuilder.CheckCompatible(prev); err == nil {
+		t.Error("error = nil, wants != nil")
+	}
+	if err := prev.CheckCompatible(inBuilder); err != nil {
+		t.Errorf("error = %v, wants = nil", err)
+	}
+}
@@ -34,16 +34,61 @@ func TestInBuilderBit(t *testing.T) {
 
 	assert(inBuilder.NewBit(), 1<<(uint(uintSize)-1))
 
-	// overflow
+	// next group
+	assert(inBuilder.NewBit(), 1<<16|1)
+	assert(inBuilder.NewBit(), 1<<16|2)
+
+	for i := 2; i < uintSize; i++ {
+		inBuilder.NewBit()
+	}
+
+	assert(inBuilder.NewBit(), 2<<16|1)
+}
+
+func TestInBuilderGroups(t *testing.T) {
+	inBuilder := NewInBuilder()
+
+	bits := make([]Bit, 47)
+	for i := range bits {
+		bits[i] = inBuilder.NewBit()
+	}
+
+	// the last group has 15 bits.
+	idxs := inBuilder.Indexes(bits[0], bits[17], bits[46])
+	if len(idxs) != 1<<15+1<<15+1<<14 {
+		t.Errorf("len(idxs) expected:%d, but was:%d", 1<<15+1<<15+1<<14, len(idxs))
+	}
+	for _, idx := range []string{"1", "ffff", "1:2", "1:ffff", "2:4000", "2:7fff"} {
+		if !containsString(idxs, idx) {
+			t.Errorf("%s not contains", idx)
+		}
+	}
+	for _, idx := range []string{"2", "1:1", "2:1", "2:8000"} {
+		if containsString(idxs, idx) {
+			t.Errorf("%s unexpectedly contains", idx)
+		}
+	}
+
+	assert := func(actual, expected interface{}) {
+		t.Helper()
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("unexpected, actual: `%v`, expected: `%v`", actual, expected)
+		}
+	}
+
+	assert(inBuilder.Filter(bits[16], bits[17]), "1:3")
+	assert(inBuilder.FilterSets(bits[46], bits[0], bits[2], bits[16]), []string{"5", "1:1", "2:4000"})
+	assert(inBuilder.Decode(idxs), []Bit{bits[0], bits[17], bits[46]})
+
+	// Filter panics with bits spanning groups
 	func() {
 		defer func() {
-			err := recover()
-			if err == nil {
+			if err := recover(); err == nil {
 				t.Errorf("panic expected")
 			}
 		}()
 
-		inBuilder.NewBit()
+		inBuilder.Filter(bits[0], bits[16])
 	}()
 }
 
@@ -98,3 +143,217 @@ func TestInBuilderFilters(t *testing.T) {
 		t.Errorf("unexpected, actual: `%v`, expected: `%v`", filter, expected)
 	}
 }
+
+func TestInBuilderDecode(t *testing.T) {
+	inBuilder := NewInBuilder()
+
+	a := inBuilder.NewBit()
+	b := inBuilder.NewBit()
+	c := inBuilder.NewBit()
+
+	bits := inBuilder.Decode(inBuilder.Indexes(a, c))
+	expected := []Bit{a, c}
+	if !reflect.DeepEqual(bits, expected) {
+		t.Errorf("unexpected, actual: `%v`, expected: `%v`", bits, expected)
+	}
+
+	bits = inBuilder.Decode(inBuilder.Indexes(b))
+	expected = []Bit{b}
+	if !reflect.DeepEqual(bits, expected) {
+		t.Errorf("unexpected, actual: `%v`, expected: `%v`", bits, expected)
+	}
+
+	if bits := inBuilder.Decode([]string{"8", "zz", "3"}); len(bits) != 0 {
+		t.Errorf("unexpected, actual: `%v`, expected: empty", bits)
+	}
+}
+
+func TestInBuilderNewBitNamed(t *testing.T) {
+	inBuilder := NewInBuilder()
+
+	published := inBuilder.MustNewBitNamed("published", 1)
+	unpublished := inBuilder.MustNewBitNamed("unpublished", 0)
+	discontinued := inBuilder.MustNewBitNamed("discontinued", 17)
+
+	assert := func(actual, expected interface{}) {
+		t.Helper()
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("unexpected, actual: `%v`, expected: `%v`", actual, expected)
+		}
+	}
+
+	assert(published, Bit(2))
+	assert(unpublished, Bit(1))
+	assert(discontinued, Bit(1<<16|2))
+
+	// anonymous bits are placed after the last bit.
+	assert(inBuilder.NewBit(), Bit(1<<16|4))
+
+	bit, ok := inBuilder.Bit("published")
+	assert(bit, published)
+	assert(ok, true)
+
+	_, ok = inBuilder.Bit("sold")
+	assert(ok, false)
+
+	name, ok := inBuilder.Name(discontinued)
+	assert(name, "discontinued")
+	assert(ok, true)
+
+	_, ok = inBuilder.Name(Bit(4))
+	assert(ok, false)
+
+	assert(inBuilder.NamedBits(), map[string]Bit{
+		"published":    published,
+		"unpublished":  unpublished,
+		"discontinued": discontinued,
+	})
+
+	t.Run("同じ名前を同じ位置に宣言した場合", func(t *testing.T) {
+		bit, err := inBuilder.NewBitNamed("published", 1)
+		assert(err, nil)
+		assert(bit, published)
+	})
+
+	for _, tc := range []struct {
+		name string
+		pos  int
+	}{
+		{"published", 2},                         // reassign
+		{"sold", 1},                              // allocated to a name
+		{"sold", 18},                             // allocated to an anonymous bit
+		{"sold", -1},                             // negative
+		{"sold", (maxInGroup + 1) * InGroupSize}, // group overflows Bit
+		{"", 3},                                  // empty name
+	} {
+		if _, err := inBuilder.NewBitNamed(tc.name, tc.pos); err == nil {
+			t.Errorf("NewBitNamed(%q, %d) error = nil, wants != nil", tc.name, tc.pos)
+		}
+	}
+}
+
+func TestInBuilderLastGroup(t *testing.T) {
+	inBuilder := NewInBuilderWithConfig(&InConfig{GroupSize: 1})
+
+	last := inBuilder.MustNewBitNamed("last", maxInGroup)
+	assert(t, "group", last.group(), maxInGroup)
+	name, _ := inBuilder.Name(last)
+	assert(t, "name", name, "last")
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected:panic, was:not panic")
+		}
+	}()
+	inBuilder.NewBit()
+}
+
+func TestInBuilderGroupSize(t *testing.T) {
+	inBuilder := NewInBuilderWithConfig(&InConfig{GroupSize: CompactInGroupSize})
+
+	bits := make([]Bit, 16)
+	for i := range bits {
+		bits[i] = inBuilder.NewBit()
+	}
+
+	assert := func(actual, expected interface{}) {
+		t.Helper()
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("unexpected, actual: `%v`, expected: `%v`", actual, expected)
+		}
+	}
+
+	assert(bits[3], Bit(8))
+	assert(bits[4], Bit(1<<16|1))
+	assert(bits[15], Bit(3<<16|8))
+
+	// up to 15 indexes for each group.
+	idxs := inBuilder.Indexes(bits...)
+	assert(len(idxs), 60)
+
+	idxs = inBuilder.Indexes(bits[0], bits[5])
+	assert(idxs, []string{
+		"1", "3", "5", "7", "9", "b", "d", "f",
+		"1:2", "1:3", "1:6", "1:7", "1:a", "1:b", "1:e", "1:f",
+	})
+
+	assert(inBuilder.FilterSets(bits[0], bits[1], bits[5]), []string{"3", "1:2"})
+	assert(inBuilder.Decode(idxs), []Bit{bits[0], bits[5]})
+
+	named := NewInBuilderWithConfig(&InConfig{GroupSize: CompactInGroupSize})
+	assert(named.MustNewBitNamed("a", 5), bits[5])
+	name, _ := named.Name(bits[5])
+	assert(name, "a")
+
+	for _, size := range []int{-1, InGroupSize + 1} {
+		func() {
+			defer func() {
+				if err := recover(); err == nil {
+					t.Errorf("GroupSize=%d panic expected", size)
+				}
+			}()
+			NewInBuilderWithConfig(&InConfig{GroupSize: size})
+		}()
+	}
+}
+
+func TestInBuilderContains(t *testing.T) {
+	inBuilder := NewInBuilderWithConfig(&InConfig{
+		GroupSize:       CompactInGroupSize,
+		SaveNoneIndexes: true,
+	})
+
+	bits := make([]Bit, 6)
+	for i := range bits {
+		bits[i] = inBuilder.NewBit()
+	}
+
+	entities := [][]Bit{
+		{bits[0], bits[1]},
+		{bits[0], bits[4]},
+		{bits[1]},
+		{},
+	}
+
+	search := func(filters []string) (found []int) {
+		for i, e := range entities {
+			idxs := inBuilder.Indexes(e...)
+			all := true
+			for _, f := range filters {
+				all = all && containsString(idxs, f)
+			}
+			if all {
+				found = append(found, i)
+			}
+		}
+		return found
+	}
+
+	assert := func(actual, expected interface{}) {
+		t.Helper()
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("unexpected, actual: `%v`, expected: `%v`", actual, expected)
+		}
+	}
+
+	assert(inBuilder.ContainsAll(bits[0], bits[4], bits[0]), []string{"1", "1:1"})
+	assert(search(inBuilder.ContainsAll(bits[0], bits[1])), []int{0})
+	assert(search(inBuilder.ContainsAll(bits[0])), []int{0, 1})
+
+	assert(inBuilder.ContainsNone(bits[0], bits[1], bits[4]), []string{"!3", "!1:1"})
+	assert(search(inBuilder.ContainsNone(bits[0])), []int{2, 3})
+	assert(search(inBuilder.ContainsNone(bits[1], bits[4])), []int{3})
+	assert(search(inBuilder.ContainsNone(bits[5])), []int{0, 1, 2, 3})
+
+	// none indexes are not decoded
+	assert(inBuilder.Decode(inBuilder.Indexes(bits[1], bits[4])), []Bit{bits[1], bits[4]})
+
+	func() {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Errorf("panic expected")
+			}
+		}()
+		NewInBuilder().ContainsNone(bits[0])
+	}()
+}
@@ -3,16 +3,14 @@ package xian
 import (
 	"fmt"
 	"reflect"
-	"strings"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 // Indexes is extra indexes for datastore query.
 type Indexes struct {
 	m    indexesMap // key=label, value=indexes
 	conf *Config
+	err  error // the first error of operations rejected by Config.Schema
 }
 
 // NewIndexes creates and initializes a new Indexes.
@@ -20,6 +18,7 @@ func NewIndexes(conf *Config) *Indexes {
 	if conf == nil {
 		conf = DefaultConfig
 	}
+	conf = conf.withSchemaComposites()
 	return &Indexes{
 		m:    make(indexesMap),
 		conf: conf,
@@ -28,10 +27,33 @@ func NewIndexes(conf *Config) *Indexes {
 
 // Add adds new indexes with a label.
 func (idxs *Indexes) Add(label string, indexes ...string) *Indexes {
+	if idxs.check(label, LabelExact) {
+		idxs.add(label, indexes...)
+	}
+	return idxs
+}
+
+// check reports whether an operation of kind on label is allowed by Config.Schema
+// and records the first error.
+func (idxs *Indexes) check(label string, kind LabelKind) bool {
+	if idxs.err != nil {
+		return false
+	}
+	if err := idxs.conf.checkLabel(label, kind); err != nil {
+		idxs.err = err
+		return false
+	}
+	return true
+}
+
+// Err returns the first error of operations rejected by Config.Schema.
+func (idxs *Indexes) Err() error {
+	return idxs.err
+}
+
+func (idxs *Indexes) add(label string, indexes ...string) {
 	for _, idx := range indexes {
-		if idxs.conf.IgnoreCase {
-			idx = strings.ToLower(idx)
-		}
+		idx = idxs.conf.normalize(label, idx)
 
 		if _, ok := idxs.m[label]; !ok {
 			idxs.m[label] = make(map[string]struct{})
@@ -39,60 +61,194 @@ func (idxs *Indexes) Add(label string, indexes ...string) *Indexes {
 
 		idxs.m[label][idx] = struct{}{}
 	}
-	return idxs
 }
 
 // AddBigrams adds new bigram indexes with a label.
 func (idxs *Indexes) AddBigrams(label string, s string) *Indexes {
-	idxs.Add(label, Bigrams(s)...)
+	if idxs.check(label, LabelPartial) {
+		idxs.add(label, Bigrams(s)...)
+	}
 	return idxs
 }
 
 // AddBiunigrams adds new biunigram indexes with a label.
 func (idxs *Indexes) AddBiunigrams(label string, s string) *Indexes {
-	idxs.Add(label, Biunigrams(s)...)
+	if idxs.check(label, LabelPartial) {
+		idxs.add(label, Biunigrams(s)...)
+	}
 	return idxs
 }
 
 // AddPrefixes adds new prefix indexes with a label.
 func (idxs *Indexes) AddPrefixes(label string, s string) *Indexes {
-	idxs.Add(label, Prefixes(s)...)
+	if idxs.check(label, LabelPrefix) {
+		idxs.add(label, Prefixes(s)...)
+	}
 	return idxs
 }
 
 // AddPrefixes adds new prefix indexes with a label.
 func (idxs *Indexes) AddSuffixes(label string, s string) *Indexes {
-	idxs.Add(label, Suffixes(s)...)
+	if idxs.check(label, LabelSuffix) {
+		idxs.add(label, Suffixes(s)...)
+	}
 	return idxs
 }
 
 // AddSomething adds new indexes with a label.
 // The indexes can be a slice or a string convertible value.
 func (idxs *Indexes) AddSomething(label string, indexes interface{}) *Indexes {
+	if !idxs.check(label, LabelExact) {
+		return idxs
+	}
+
 	v := reflect.ValueOf(indexes)
 
 	switch v.Kind() {
 	case reflect.Array, reflect.Slice:
 		for i := 0; i < v.Len(); i++ {
-			idxs.Add(label, fmt.Sprintf("%v", v.Index(i).Interface()))
+			idxs.add(label, fmt.Sprintf("%v", v.Index(i).Interface()))
 		}
 	case timeKind:
 		unix := v.Interface().(time.Time).UnixNano()
-		idxs.Add(label, fmt.Sprintf("%d", unix))
+		idxs.add(label, fmt.Sprintf("%d", unix))
 	default:
-		idxs.Add(label, fmt.Sprintf("%v", v.Interface()))
+		idxs.add(label, fmt.Sprintf("%v", v.Interface()))
 	}
 
 	return idxs
 }
 
 // Build builds indexes to save.
+// Indexes exceeding MaxIndexesSize are degraded if Config.BudgetPolicy is set.
 func (idxs Indexes) Build() ([]string, error) {
+	built, _, err := idxs.BuildWithReport()
+	return built, err
+}
+
+// BuildWithReport builds indexes to save and reports indexes degraded by Config.BudgetPolicy.
+// IndexDegraded is saved with degraded indexes.
+// It returns the first error of operations rejected by Config.Schema.
+func (idxs Indexes) BuildWithReport() ([]string, *BuildReport, error) {
+	if idxs.err != nil {
+		return nil, nil, idxs.err
+	}
+
+	report := &BuildReport{}
+
+	built, err := idxs.build(idxs.m, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	policy := idxs.conf.BudgetPolicy
+	if len(built) <= MaxIndexesSize || policy == nil {
+		if len(built) > MaxIndexesSize {
+			return nil, nil, newIndexSizeError(idxs.conf, built, len(built))
+		}
+		return built, report, nil
+	}
+
+	// reserve for IndexDegraded
+	const budget = MaxIndexesSize - 1
+
+	original := built
+	m := copyIndexesMap(idxs.m)
+	composite := true
+
+	drop := func(label, token string) {
+		delete(m[label], token)
+		if report.DroppedTokens == nil {
+			report.DroppedTokens = make(map[string]int)
+		}
+		report.DroppedTokens[label]++
+	}
+
+	for _, strategy := range policy.Strategies {
+		if len(built) <= budget {
+			break
+		}
+
+		switch strategy {
+		case DropCompositeIndexes:
+			composite = false
+			report.CompositeDropped = true
+			report.compositeIdxLabels = idxs.conf.CompositeIdxLabels
+		case DropLongestTokens:
+			tokens := policy.degradableTokens(m)
+			n, err := idxs.fewestDrops(len(tokens), budget, composite, func(k int) indexesMap {
+				dropped := copyIndexesMap(m)
+				for _, t := range tokens[:k] {
+					delete(dropped[t.label], t.token)
+				}
+				return dropped
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, t := range tokens[:n] {
+				drop(t.label, t.token)
+			}
+		case DropLabels:
+			labels := policy.degradableLabels()
+			n, err := idxs.fewestDrops(len(labels), budget, composite, func(k int) indexesMap {
+				dropped := copyIndexesMap(m)
+				for _, label := range labels[:k] {
+					dropped[label] = make(map[string]struct{})
+				}
+				return dropped
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, label := range labels[:n] {
+				for t := range m[label] {
+					drop(label, t)
+				}
+			}
+		}
+
+		if built, err = idxs.build(m, composite); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(built) > budget {
+		serr := newIndexSizeError(idxs.conf, original, len(original))
+		// including IndexDegraded
+		serr.DegradedSize = len(built) + 1
+		return nil, nil, serr
+	}
+
+	return append(built, IndexDegraded), report, nil
+}
+
+// fewestDrops returns the fewest number of the first n items to drop to fit indexes in budget,
+// or n if dropping all of them is not enough. without returns indexes without the first k items.
+// Sizes are measured by building since dropping a token also removes its composite indexes.
+func (idxs Indexes) fewestDrops(n, budget int, composite bool, without func(k int) indexesMap) (int, error) {
+	// dropping no items exceeds budget.
+	lo, hi := 1, n
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		built, err := idxs.build(without(mid), composite)
+		if err != nil {
+			return 0, err
+		}
+		if len(built) <= budget {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return hi, nil
+}
 
-	built := buildIndexes(idxs.m, nil)
+func (idxs Indexes) build(m indexesMap, composite bool) ([]string, error) {
+	built := buildIndexes(idxs.conf, m, nil)
 
-	if len(idxs.conf.CompositeIdxLabels) > 1 {
-		cis, err := createCompositeIndexes(idxs.conf.CompositeIdxLabels, idxs.m, false)
+	if composite && len(idxs.conf.CompositeIdxLabels) > 1 {
+		cis, err := createCompositeIndexes(idxs.conf, m)
 		if err != nil {
 			return nil, err
 		}
@@ -103,8 +259,8 @@ func (idxs Indexes) Build() ([]string, error) {
 		built = append(built, IndexNoFilters)
 	}
 
-	if len(built) > MaxIndexesSize {
-		return nil, errors.Errorf("index size exceeds %d", MaxIndexesSize)
+	if idxs.conf.SaveFingerprintIndex {
+		built = append(built, idxs.conf.FingerprintIndex())
 	}
 
 	return built, nil
@@ -147,7 +147,7 @@ func TestBuildIndex(t *testing.T) {
 	t.Run("ConfigのCompositeIdxLabelsがMaxCompositeIndexLabelsより大きい場合", func(t *testing.T) {
 		labels := make([]string, MaxCompositeIndexLabels+1)
 		for i := 0; i < len(labels); i++ {
-			labels[i] = string('a' + i)
+			labels[i] = string(rune('a' + i))
 		}
 
 		idx := NewIndexes(&Config{CompositeIdxLabels: labels})
@@ -193,7 +193,7 @@ func TestMustBuildIndex(t *testing.T) {
 
 		labels := make([]string, MaxCompositeIndexLabels+1)
 		for i := 0; i < len(labels); i++ {
-			labels[i] = string('a' + i)
+			labels[i] = string(rune('a' + i))
 		}
 
 		idx := NewIndexes(&Config{CompositeIdxLabels: labels})
@@ -320,3 +320,195 @@ func assertBuiltIndex(t *testing.T, actual, expected []string) {
 		t.Errorf("unexpected, actual: `%v`, expected: `%v`", actual, expected)
 	}
 }
+
+func TestIndexConfigCompositeIdxMaxSize(t *testing.T) {
+	labels := make([]string, 12)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("l%d", i)
+	}
+
+	conf := MustValidateConfig(&Config{CompositeIdxLabels: labels, CompositeIdxMaxSize: 2})
+
+	idx := NewIndexes(conf)
+	idx.Add("l0", "a")
+	idx.Add("l1", "b", "c")
+	idx.Add("l11", "d")
+
+	built := idx.MustBuild()
+	assertBuiltIndex(t, built, []string{
+		"l0 a",
+		"l1 b",
+		"l1 c",
+		"l11 d",
+		"3 a;b",
+		"3 a;c",
+		fmt.Sprintf("%d a;d", 1|1<<11),
+		fmt.Sprintf("%d b;d", 1<<1|1<<11),
+		fmt.Sprintf("%d c;d", 1<<1|1<<11),
+	})
+}
+
+func TestIndexConfigCompositeIdxCombinations(t *testing.T) {
+	conf := MustValidateConfig(&Config{
+		CompositeIdxLabels: []string{"s", "c", "p", "h"},
+		CompositeIdxCombinations: [][]string{
+			{"c", "s"},
+			{"s", "c", "p"},
+			{"p", "h"},
+		},
+	})
+
+	idx := NewIndexes(conf)
+	idx.Add("s", "1")
+	idx.Add("c", "sports", "cooking")
+	idx.Add("p", "p<3000")
+
+	// {p, h} is not saved since h has no tokens.
+	assertBuiltIndex(t, idx.MustBuild(), []string{
+		"s 1",
+		"c sports",
+		"c cooking",
+		"p p<3000",
+		"3 1;cooking",
+		"3 1;sports",
+		"7 1;cooking;p<3000",
+		"7 1;sports;p<3000",
+	})
+}
+
+func TestIndexConfigBudgetPolicy(t *testing.T) {
+	addLabels := func(idx *Indexes, n int) {
+		for i := 0; i < n; i++ {
+			idx.Add(fmt.Sprintf("label%d", i), "abc")
+		}
+	}
+
+	t.Run("複合インデックスを削除", func(t *testing.T) {
+		conf := &Config{
+			CompositeIdxLabels: []string{"a", "b"},
+			BudgetPolicy:       &BudgetPolicy{Strategies: []BudgetStrategy{DropCompositeIndexes}},
+		}
+
+		idx := NewIndexes(conf)
+		for i := 0; i < 30; i++ {
+			idx.Add("a", fmt.Sprintf("a%d", i))
+			idx.Add("b", fmt.Sprintf("b%d", i))
+		}
+
+		built, report, err := idx.BuildWithReport()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert(t, "len(built)", len(built), 61)
+		assert(t, "degraded index", containsString(built, IndexDegraded), true)
+		assert(t, "CompositeDropped", report.CompositeDropped, true)
+		assert(t, "Degraded", report.Degraded(), true)
+		assert(t, "IncompleteLabels", fmt.Sprint(report.IncompleteLabels()), "[a b]")
+	})
+
+	t.Run("長いトークンから削除", func(t *testing.T) {
+		conf := &Config{
+			BudgetPolicy: &BudgetPolicy{
+				Strategies: []BudgetStrategy{DropLongestTokens},
+				Priorities: map[string]int{"tp": 1},
+			},
+		}
+
+		idx := NewIndexes(conf)
+		addLabels(idx, 500)
+		idx.AddPrefixes("tp", "abcdefghijklmnopqrstu")
+
+		built, report, err := idx.BuildWithReport()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert(t, "len(built)", len(built), MaxIndexesSize)
+		assert(t, "shortest prefix", containsString(built, "tp abcdefghijk"), true)
+		assert(t, "longest prefix", containsString(built, "tp abcdefghijkl"), false)
+		assert(t, "DroppedTokens", report.DroppedTokens["tp"], 10)
+		assert(t, "IncompleteLabels", report.IncompleteLabels()[0], "tp")
+	})
+
+	t.Run("複合インデックスのラベルのトークンを一度に削除", func(t *testing.T) {
+		conf := &Config{
+			CompositeIdxLabels: []string{"a", "b"},
+			BudgetPolicy: &BudgetPolicy{
+				Strategies: []BudgetStrategy{DropLongestTokens},
+				Priorities: map[string]int{"a": 1},
+			},
+		}
+
+		idx := NewIndexes(conf)
+		for i := 0; i < 40; i++ {
+			idx.Add("a", fmt.Sprintf("a%02d", i))
+		}
+		for i := 0; i < 12; i++ {
+			idx.Add("b", fmt.Sprintf("b%02d", i))
+		}
+
+		built, report, err := idx.BuildWithReport()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// 40+12+40*12 indexes exceed 511 by 21, and dropping a token of a removes 1+12 indexes.
+		assert(t, "DroppedTokens", report.DroppedTokens["a"], 2)
+		assert(t, "len(built)", len(built), 38+12+38*12+1)
+		assert(t, "IncompleteLabels", fmt.Sprint(report.IncompleteLabels()), "[a]")
+	})
+
+	t.Run("優先度の低いラベルから削除", func(t *testing.T) {
+		conf := &Config{
+			BudgetPolicy: &BudgetPolicy{
+				Strategies: []BudgetStrategy{DropLabels},
+				Priorities: map[string]int{"tp": 2, "ts": 1},
+			},
+		}
+
+		idx := NewIndexes(conf)
+		addLabels(idx, 490)
+		idx.AddPrefixes("tp", "abcdefghijklmnopqrstu")
+		idx.AddSuffixes("ts", "abcdefghijklmnopqrstu")
+
+		built, report, err := idx.BuildWithReport()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert(t, "len(built)", len(built), 490+21+1)
+		assert(t, "prefix", containsString(built, "tp abc"), true)
+		assert(t, "suffix", containsString(built, "ts stu"), false)
+		assert(t, "DroppedTokens", report.DroppedTokens["ts"], 21)
+		assert(t, "Build", len(idx.MustBuild()), len(built))
+	})
+
+	t.Run("サイズ内の場合は劣化しない", func(t *testing.T) {
+		conf := &Config{
+			BudgetPolicy: &BudgetPolicy{Strategies: []BudgetStrategy{DropCompositeIndexes}},
+		}
+
+		idx := NewIndexes(conf)
+		addLabels(idx, MaxIndexesSize)
+
+		built, report, err := idx.BuildWithReport()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert(t, "len(built)", len(built), MaxIndexesSize)
+		assert(t, "Degraded", report.Degraded(), false)
+	})
+
+	t.Run("劣化してもサイズを超える場合", func(t *testing.T) {
+		conf := &Config{
+			BudgetPolicy: &BudgetPolicy{
+				Strategies: []BudgetStrategy{DropLongestTokens, DropLabels},
+				Priorities: map[string]int{"label0": 1},
+			},
+		}
+
+		idx := NewIndexes(conf)
+		addLabels(idx, MaxIndexesSize+2)
+
+		if _, _, err := idx.BuildWithReport(); err == nil {
+			t.Error("error = nil, wants != nil")
+		}
+	})
+}
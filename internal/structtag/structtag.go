@@ -0,0 +1,55 @@
+// Package structtag parses struct tags of xian shared by xian.Indexes.AddStruct and cmd/xiangen.
+package structtag
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Name is the key of the struct tag.
+const Name = "xian"
+
+const separator = ";"
+
+// Options of the struct tag.
+const (
+	Bigrams    = "bigrams"
+	Biunigrams = "biunigrams"
+	Prefixes   = "prefixes"
+	Suffixes   = "suffixes"
+
+	inPrefix = "in="
+)
+
+// Tag is a label and options of the struct tag.
+type Tag struct {
+	Label   string
+	Options []string
+	In      string // InBuilder variable for xiangen
+}
+
+// Parse parses a tag like `xian:"ti,bigrams,biunigrams;tp,prefixes"`.
+func Parse(tag string) ([]Tag, error) {
+	var tags []Tag
+	for _, s := range strings.Split(tag, separator) {
+		parts := strings.Split(s, ",")
+		t := Tag{Label: strings.TrimSpace(parts[0])}
+		if t.Label == "" {
+			return nil, errors.Errorf("empty label in tag %q", tag)
+		}
+		for _, o := range parts[1:] {
+			o = strings.TrimSpace(o)
+			switch {
+			case o == Bigrams, o == Biunigrams, o == Prefixes, o == Suffixes:
+				t.Options = append(t.Options, o)
+			case strings.HasPrefix(o, inPrefix):
+				t.In = strings.TrimPrefix(o, inPrefix)
+			default:
+				return nil, errors.Errorf("unknown option %q in tag %q", o, tag)
+			}
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
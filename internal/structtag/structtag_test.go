@@ -0,0 +1,27 @@
+package structtag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tags, err := Parse("ti, bigrams, biunigrams;tp,prefixes;s,in=statusInBuilder")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Tag{
+		{Label: "ti", Options: []string{Bigrams, Biunigrams}},
+		{Label: "tp", Options: []string{Prefixes}},
+		{Label: "s", In: "statusInBuilder"},
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("unexpected, actual: `%#v`, expected: `%#v`", tags, expected)
+	}
+
+	for _, tag := range []string{"", "ti;", ",bigrams", "ti,trigrams"} {
+		if _, err := Parse(tag); err == nil {
+			t.Errorf("%q: error = nil, wants != nil", tag)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package xian
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ReservedLabelPrefix is the prefix of labels reserved for special indexes such as IndexNoFilters.
+const ReservedLabelPrefix = "__"
+
+// LabelError describes an invalid label.
+type LabelError struct {
+	Label  string
+	Reason string
+}
+
+func (e *LabelError) Error() string {
+	return fmt.Sprintf("invalid label %q: %s", e.Label, e.Reason)
+}
+
+// validateLabel checks whether label can be used in indexes with the configuration.
+// Labels must not be empty nor start with ReservedLabelPrefix.
+// Without EscapeSeparators, labels must not contain a space,
+// and labels must not consist of digits if composite indexes are enabled.
+func (conf *Config) validateLabel(label string) error {
+	switch {
+	case label == "":
+		return &LabelError{label, "empty"}
+	case strings.HasPrefix(label, ReservedLabelPrefix):
+		return &LabelError{label, fmt.Sprintf("prefix %q is reserved", ReservedLabelPrefix)}
+	case conf.EscapeSeparators:
+		return nil
+	case strings.Contains(label, " "):
+		return &LabelError{label, "contains a space"}
+	case len(conf.CompositeIdxLabels) > 1 && isDigits(label):
+		return &LabelError{label, "digits collide with composite indexes"}
+	}
+	return nil
+}
+
+// validateLabels validates labels in CompositeIdxLabels, Schema and BudgetPolicy.
+func (conf *Config) validateLabels() error {
+	seen := make(map[string]bool, len(conf.CompositeIdxLabels))
+	for _, label := range conf.CompositeIdxLabels {
+		if err := conf.validateLabel(label); err != nil {
+			return err
+		}
+		if seen[label] {
+			return &LabelError{label, "duplicated in CompositeIdxLabels"}
+		}
+		seen[label] = true
+	}
+
+	if conf.Schema != nil {
+		for _, l := range conf.Schema.labels {
+			if err := conf.validateLabel(l.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if conf.BudgetPolicy != nil {
+		labels := make([]string, 0, len(conf.BudgetPolicy.Priorities))
+		for label := range conf.BudgetPolicy.Priorities {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			if err := conf.validateLabel(label); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
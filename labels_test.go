@@ -0,0 +1,77 @@
+package xian
+
+import (
+	"testing"
+)
+
+func TestValidateConfigLabels(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		conf  *Config
+		label string
+	}{
+		{"空のラベル", &Config{CompositeIdxLabels: []string{"s", ""}}, ""},
+		{"スペースを含むラベル", &Config{CompositeIdxLabels: []string{"s", "a b"}}, "a b"},
+		{"予約されたラベル", &Config{CompositeIdxLabels: []string{"s", IndexNoFilters}}, IndexNoFilters},
+		{"数字のラベル", &Config{CompositeIdxLabels: []string{"s", "3"}}, "3"},
+		{"重複したラベル", &Config{CompositeIdxLabels: []string{"s", "c", "s"}}, "s"},
+		{"CompositeIdxCombinationsにないラベル", &Config{
+			CompositeIdxLabels:       []string{"s", "c"},
+			CompositeIdxCombinations: [][]string{{"s", "x"}},
+		}, "x"},
+		{"Schemaのラベル", &Config{
+			Schema: MustNewSchema(&LabelSchema{Name: "a b", Kind: LabelExact}),
+		}, "a b"},
+		{"BudgetPolicyのラベル", &Config{
+			BudgetPolicy: &BudgetPolicy{Priorities: map[string]int{"ok": 1, "a b": 2}},
+		}, "a b"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ValidateConfig(tc.conf)
+			lerr, ok := err.(*LabelError)
+			if !ok {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assert(t, "Label", lerr.Label, tc.label)
+		})
+	}
+
+	t.Run("EscapeSeparatorsの場合", func(t *testing.T) {
+		_, err := ValidateConfig(&Config{EscapeSeparators: true, CompositeIdxLabels: []string{"s", "a b", "3"}})
+		if err != nil {
+			t.Errorf("error = %s, wants = nil", err)
+		}
+	})
+
+	t.Run("複合インデックスがない場合の数字のラベル", func(t *testing.T) {
+		if _, err := NewIndexes(nil).Add("3", "x").Build(); err != nil {
+			t.Errorf("error = %s, wants = nil", err)
+		}
+	})
+}
+
+func TestAddInvalidLabel(t *testing.T) {
+	conf := &Config{CompositeIdxLabels: []string{"s", "c"}}
+
+	for _, tc := range []struct {
+		name    string
+		indexes *Indexes
+		filters *Filters
+		label   string
+	}{
+		{"空のラベル", NewIndexes(conf).Add("", "x"), NewFilters(conf).Add("", "x"), ""},
+		{"スペースを含むラベル", NewIndexes(conf).AddBiunigrams("t i", "x"), NewFilters(conf).AddPrefix("t i", "x"), "t i"},
+		{"予約されたラベル", NewIndexes(conf).AddSomething("__x", 1), NewFilters(conf).AddSuffix("__x", "x"), "__x"},
+		{"数字のラベル", NewIndexes(conf).Add("3", "a;b"), NewFilters(conf).Add("3", "a;b"), "3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, err := range []error{tc.indexes.Err(), tc.filters.Err()} {
+				lerr, ok := err.(*LabelError)
+				if !ok {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				assert(t, "Label", lerr.Label, tc.label)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package xian
+
+import (
+	"strings"
+)
+
+type matchKind int
+
+const (
+	matchContains matchKind = iota
+	matchPrefix
+	matchSuffix
+)
+
+// condition is a match condition which filters can't verify strictly.
+type condition struct {
+	kind  matchKind
+	label string
+	s     string // normalized
+}
+
+// Matcher verifies candidate entities fetched with Filters.
+//
+// Bigram and biunigram filters can match texts which contain all the bigrams of
+// a query in another order. Matcher removes such false positives by checking
+// the original values of entities.
+type Matcher struct {
+	conds []condition
+	conf  *Config
+}
+
+// Values is original field values of an entity.
+// key=label, value=values added to Indexes with the label.
+type Values map[string][]string
+
+// Matcher returns a Matcher which verifies partial, prefix and suffix match
+// conditions added to filters.
+func (filters *Filters) Matcher() *Matcher {
+	conds := make([]condition, len(filters.conds))
+	copy(conds, filters.conds)
+	return &Matcher{
+		conds: conds,
+		conf:  filters.conf,
+	}
+}
+
+// Match reports whether values satisfy all the conditions.
+// A condition whose label has no values is unsatisfied.
+//
+// Partial match conditions require a value containing the query.
+// Prefix and suffix conditions require a word with the prefix or suffix
+// since Prefixes and Suffixes create tokens for each word.
+func (m *Matcher) Match(values Values) bool {
+	for _, cond := range m.conds {
+		if !m.matchCondition(cond, values[cond.label]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Matcher) matchCondition(cond condition, values []string) bool {
+	for _, v := range values {
+		v = m.conf.normalize(cond.label, v)
+
+		switch cond.kind {
+		case matchContains:
+			if strings.Contains(v, cond.s) {
+				return true
+			}
+		case matchPrefix:
+			for _, w := range strings.Split(v, " ") {
+				if strings.HasPrefix(w, cond.s) {
+					return true
+				}
+			}
+		case matchSuffix:
+			for _, w := range strings.Split(v, " ") {
+				if strings.HasSuffix(w, cond.s) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
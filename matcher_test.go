@@ -0,0 +1,82 @@
+package xian
+
+import (
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	t.Run("部分一致", func(t *testing.T) {
+		filters := NewFilters(nil).AddBiunigrams("ti", "abcab")
+
+		idxs := NewIndexes(nil).AddBiunigrams("ti", "cabc").MustBuild()
+		for _, f := range filters.MustBuild() {
+			if !containsString(idxs, f) {
+				t.Fatalf("filter: %s not contains", f)
+			}
+		}
+
+		m := filters.Matcher()
+		assert(t, "false positive", m.Match(Values{"ti": {"cabc"}}), false)
+		assert(t, "contains", m.Match(Values{"ti": {"xabcabx"}}), true)
+		assert(t, "one of values", m.Match(Values{"ti": {"cabc", "abcab"}}), true)
+		assert(t, "no values", m.Match(Values{"other": {"abcab"}}), false)
+	})
+
+	t.Run("1文字の部分一致", func(t *testing.T) {
+		m := NewFilters(nil).AddBigrams("ti", "あ").Matcher()
+		assert(t, "contains", m.Match(Values{"ti": {"いあう"}}), true)
+		assert(t, "not contains", m.Match(Values{"ti": {"いう"}}), false)
+	})
+
+	t.Run("スペースを含む部分一致", func(t *testing.T) {
+		m := NewFilters(nil).AddBiunigrams("ti", "harry po").Matcher()
+		assert(t, "contains", m.Match(Values{"ti": {"Oh harry potter"}}), true)
+		assert(t, "words in another order", m.Match(Values{"ti": {"potter harry"}}), false)
+	})
+
+	t.Run("前方一致と後方一致", func(t *testing.T) {
+		m := NewFilters(nil).AddPrefix("tp", "har").AddSuffix("ts", ReverseSuffix("ter")).Matcher()
+		assert(t, "match", m.Match(Values{"tp": {"the harry"}, "ts": {"potter the"}}), true)
+		assert(t, "prefix unmatch", m.Match(Values{"tp": {"charry"}, "ts": {"potter"}}), false)
+		assert(t, "suffix unmatch", m.Match(Values{"tp": {"harry"}, "ts": {"terry"}}), false)
+	})
+
+	t.Run("IgnoreCase", func(t *testing.T) {
+		conf := &Config{IgnoreCase: true}
+		m := NewFilters(conf).AddBiunigrams("ti", "HaRRy").Matcher()
+		assert(t, "match", m.Match(Values{"ti": {"Harry Potter"}}), true)
+
+		m = NewFilters(nil).AddBiunigrams("ti", "HaRRy").Matcher()
+		assert(t, "case sensitive", m.Match(Values{"ti": {"Harry Potter"}}), false)
+	})
+
+	t.Run("完全一致は検証しない", func(t *testing.T) {
+		m := NewFilters(nil).Add("s", "1").AddSomething("n", 123).Matcher()
+		assert(t, "match", m.Match(Values{}), true)
+	})
+}
+
+func TestMatcherWithBuiltIndexes(t *testing.T) {
+	conf := &Config{IgnoreCase: true}
+	idxs := NewIndexes(conf).
+		AddBiunigrams("ti", "Harry Potter").
+		AddPrefixes("tp", "Harry Potter").
+		AddSuffixes("ts", "Harry Potter").
+		MustBuild()
+	values := Values{"ti": {"Harry Potter"}, "tp": {"Harry Potter"}, "ts": {"Harry Potter"}}
+
+	for name, filters := range map[string]*Filters{
+		"部分一致": NewFilters(conf).AddBiunigrams("ti", "rry po"),
+		"前方一致": NewFilters(conf).AddPrefix("tp", "pot"),
+		"後方一致": NewFilters(conf).AddSuffix("ts", ReverseSuffix("ter")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, f := range filters.MustBuild() {
+				if !containsString(idxs, f) {
+					t.Errorf("filter: %s not contains", f)
+				}
+			}
+			assert(t, "match", filters.Matcher().Match(values), true)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Package migrate rewrites indexes of xian saved with an old configuration.
+//
+// Diff compares saved indexes with rebuilt ones, and Migrator drives batches of
+// iterating, rebuilding and writing entities with a checkpoint to resume from.
+package migrate
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBatchSize is the default number of records in a batch.
+const DefaultBatchSize = 100
+
+// Diff is the difference between old and new indexes.
+type Diff struct {
+	// Added is the indexes only in new indexes.
+	Added []string
+	// Removed is the indexes only in old indexes.
+	Removed []string
+}
+
+// DiffIndexes compares old and new indexes regardless of order and duplicates.
+func DiffIndexes(old, new []string) *Diff {
+	oldSet := toSet(old)
+	newSet := toSet(new)
+
+	diff := &Diff{}
+	for idx := range newSet {
+		if _, ok := oldSet[idx]; !ok {
+			diff.Added = append(diff.Added, idx)
+		}
+	}
+	for idx := range oldSet {
+		if _, ok := newSet[idx]; !ok {
+			diff.Removed = append(diff.Removed, idx)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+
+	return diff
+}
+
+func toSet(indexes []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(indexes))
+	for _, idx := range indexes {
+		set[idx] = struct{}{}
+	}
+	return set
+}
+
+// NeedsWrite reports whether indexes are changed.
+func (d *Diff) NeedsWrite() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0
+}
+
+// Record is an entity to migrate.
+type Record struct {
+	// Key identifies the entity.
+	Key string
+	// Indexes is the saved indexes.
+	Indexes []string
+	// Entity is the entity to rebuild indexes from.
+	Entity interface{}
+}
+
+// Update is a record whose indexes need to be written.
+type Update struct {
+	Record *Record
+	// Indexes is the rebuilt indexes.
+	Indexes []string
+	Diff    *Diff
+}
+
+// Source iterates records.
+type Source interface {
+	// Next returns records after cursor and the cursor of the next batch.
+	// cursor is empty for the first batch. Empty records end the iteration.
+	Next(ctx context.Context, cursor string, limit int) (records []*Record, next string, err error)
+}
+
+// Writer writes rebuilt indexes.
+type Writer interface {
+	// Write writes indexes of updates. It's not called for batches without updates.
+	Write(ctx context.Context, updates []*Update) error
+}
+
+// Checkpointer saves a cursor to resume from.
+type Checkpointer interface {
+	// Load returns the saved cursor. It's empty if nothing is saved.
+	Load(ctx context.Context) (string, error)
+	// Save saves the cursor of the next batch after a batch is written.
+	Save(ctx context.Context, cursor string) error
+}
+
+// RebuildFunc builds new indexes of a record.
+type RebuildFunc func(ctx context.Context, r *Record) ([]string, error)
+
+// Stats is the progress of a migration.
+type Stats struct {
+	// Scanned is the number of records rebuilt.
+	Scanned int
+	// Written is the number of records written, or needing writes with DryRun.
+	Written int
+	// Cursor is the cursor of the next batch.
+	Cursor string
+}
+
+// Migrator rebuilds and writes indexes of records in batches.
+type Migrator struct {
+	Source  Source
+	Rebuild RebuildFunc
+	Writer  Writer
+	// Checkpoint is optional. The migration starts from the beginning if it's nil.
+	Checkpoint Checkpointer
+	// BatchSize is the number of records in a batch. DefaultBatchSize is used if it's zero.
+	BatchSize int
+	// DryRun skips Writer and Checkpoint.Save to count records needing writes.
+	DryRun bool
+}
+
+// Run migrates records from the checkpoint until Source ends or an error occurs.
+// Stats is returned with an error to report the progress.
+// Run can be called again to resume from the last saved checkpoint.
+func (m *Migrator) Run(ctx context.Context) (*Stats, error) {
+	if m.Source == nil || m.Rebuild == nil || (m.Writer == nil && !m.DryRun) {
+		return nil, errors.New("Source, Rebuild and Writer are required")
+	}
+
+	batchSize := m.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	stats := &Stats{}
+
+	if m.Checkpoint != nil {
+		cursor, err := m.Checkpoint.Load(ctx)
+		if err != nil {
+			return stats, errors.Wrap(err, "load checkpoint")
+		}
+		stats.Cursor = cursor
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		records, next, err := m.Source.Next(ctx, stats.Cursor, batchSize)
+		if err != nil {
+			return stats, errors.Wrapf(err, "read after %q", stats.Cursor)
+		}
+		if len(records) == 0 {
+			return stats, nil
+		}
+
+		var updates []*Update
+		for _, r := range records {
+			indexes, err := m.Rebuild(ctx, r)
+			if err != nil {
+				return stats, errors.Wrapf(err, "rebuild %s", r.Key)
+			}
+			stats.Scanned++
+
+			if diff := DiffIndexes(r.Indexes, indexes); diff.NeedsWrite() {
+				updates = append(updates, &Update{Record: r, Indexes: indexes, Diff: diff})
+			}
+		}
+
+		if !m.DryRun {
+			if len(updates) > 0 {
+				if err := m.Writer.Write(ctx, updates); err != nil {
+					return stats, errors.Wrapf(err, "write after %q", stats.Cursor)
+				}
+			}
+			if m.Checkpoint != nil {
+				if err := m.Checkpoint.Save(ctx, next); err != nil {
+					return stats, errors.Wrap(err, "save checkpoint")
+				}
+			}
+		}
+
+		stats.Written += len(updates)
+		stats.Cursor = next
+	}
+}
@@ -0,0 +1,168 @@
+package migrate
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/knightso/xian"
+	"github.com/pkg/errors"
+)
+
+func TestDiffIndexes(t *testing.T) {
+	diff := DiffIndexes([]string{"a 1", "b 2", "b 2", "c 3"}, []string{"c 3", "a 1", "d 4"})
+	if !reflect.DeepEqual(diff.Added, []string{"d 4"}) {
+		t.Errorf("Added: %v", diff.Added)
+	}
+	if !reflect.DeepEqual(diff.Removed, []string{"b 2"}) {
+		t.Errorf("Removed: %v", diff.Removed)
+	}
+	if !diff.NeedsWrite() {
+		t.Error("NeedsWrite = false, wants true")
+	}
+
+	if DiffIndexes([]string{"a 1", "b 2"}, []string{"b 2", "a 1", "a 1"}).NeedsWrite() {
+		t.Error("NeedsWrite = true, wants false")
+	}
+}
+
+type book struct {
+	title string
+}
+
+type memoryStore struct {
+	keys    []string
+	books   map[string]*book
+	indexes map[string][]string
+	failAt  string
+}
+
+func newMemoryStore(conf *xian.Config, titles map[string]string) *memoryStore {
+	s := &memoryStore{
+		books:   make(map[string]*book),
+		indexes: make(map[string][]string),
+	}
+	for key, title := range titles {
+		s.keys = append(s.keys, key)
+		s.books[key] = &book{title}
+		s.indexes[key] = xian.NewIndexes(conf).AddBiunigrams("ti", title).MustBuild()
+	}
+	sort.Strings(s.keys)
+	return s
+}
+
+func (s *memoryStore) Next(ctx context.Context, cursor string, limit int) ([]*Record, string, error) {
+	i := sort.SearchStrings(s.keys, cursor)
+	if i < len(s.keys) && s.keys[i] == cursor {
+		i++
+	}
+
+	var records []*Record
+	for ; i < len(s.keys) && len(records) < limit; i++ {
+		key := s.keys[i]
+		records = append(records, &Record{Key: key, Indexes: s.indexes[key], Entity: s.books[key]})
+	}
+	if len(records) == 0 {
+		return nil, cursor, nil
+	}
+	return records, records[len(records)-1].Key, nil
+}
+
+func (s *memoryStore) Write(ctx context.Context, updates []*Update) error {
+	for _, u := range updates {
+		if u.Record.Key == s.failAt {
+			return errors.New("write failed")
+		}
+	}
+	for _, u := range updates {
+		s.indexes[u.Record.Key] = u.Indexes
+	}
+	return nil
+}
+
+type memoryCheckpoint struct {
+	cursor string
+}
+
+func (c *memoryCheckpoint) Load(ctx context.Context) (string, error) {
+	return c.cursor, nil
+}
+
+func (c *memoryCheckpoint) Save(ctx context.Context, cursor string) error {
+	c.cursor = cursor
+	return nil
+}
+
+func TestMigrator(t *testing.T) {
+	old := &xian.Config{}
+	conf := &xian.Config{IgnoreCase: true}
+
+	store := newMemoryStore(old, map[string]string{
+		"1": "Harry", "2": "abc", "3": "Potter", "4": "xyz", "5": "Go",
+	})
+	checkpoint := &memoryCheckpoint{}
+
+	m := &Migrator{
+		Source: store,
+		Rebuild: func(ctx context.Context, r *Record) ([]string, error) {
+			return xian.NewIndexes(conf).AddBiunigrams("ti", r.Entity.(*book).title).Build()
+		},
+		Writer:     store,
+		Checkpoint: checkpoint,
+		BatchSize:  2,
+	}
+
+	t.Run("DryRun", func(t *testing.T) {
+		dryRun := *m
+		dryRun.DryRun = true
+		stats, err := dryRun.Run(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.Scanned != 5 || stats.Written != 3 {
+			t.Errorf("unexpected stats: %+v", stats)
+		}
+		if checkpoint.cursor != "" {
+			t.Errorf("checkpoint saved: %s", checkpoint.cursor)
+		}
+	})
+
+	t.Run("書き込み失敗", func(t *testing.T) {
+		store.failAt = "3"
+		stats, err := m.Run(context.Background())
+		if err == nil {
+			t.Fatal("error = nil, wants != nil")
+		}
+		if stats.Written != 1 || checkpoint.cursor != "2" {
+			t.Errorf("unexpected stats: %+v, checkpoint: %s", stats, checkpoint.cursor)
+		}
+	})
+
+	t.Run("再開", func(t *testing.T) {
+		store.failAt = ""
+		stats, err := m.Run(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.Scanned != 3 || stats.Written != 2 || checkpoint.cursor != "5" {
+			t.Errorf("unexpected stats: %+v, checkpoint: %s", stats, checkpoint.cursor)
+		}
+
+		for key, b := range store.books {
+			expected := xian.NewIndexes(conf).AddBiunigrams("ti", b.title).MustBuild()
+			if DiffIndexes(store.indexes[key], expected).NeedsWrite() {
+				t.Errorf("%s is not migrated", key)
+			}
+		}
+	})
+
+	t.Run("キャンセル", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		checkpoint.cursor = ""
+		if _, err := m.Run(ctx); err != context.Canceled {
+			t.Errorf("err expected:%v, but was:%v", context.Canceled, err)
+		}
+	})
+}
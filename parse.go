@@ -0,0 +1,125 @@
+package xian
+
+import (
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// EntryKind is a kind of a built index.
+type EntryKind int
+
+const (
+	// EntryLabel is an index of a label like "ti ab".
+	EntryLabel EntryKind = iota + 1
+	// EntryComposite is a composite index like "3 a;b".
+	EntryComposite
+	// EntryNoFilters is IndexNoFilters.
+	EntryNoFilters
+	// EntryDegraded is IndexDegraded.
+	EntryDegraded
+	// EntryFingerprint is a fingerprint index saved with Config.SaveFingerprintIndex.
+	EntryFingerprint
+)
+
+// Component is a label and a token in a composite index.
+type Component struct {
+	Label string
+	Token string
+}
+
+// Entry is a parsed index.
+type Entry struct {
+	Kind EntryKind
+	// Label and Token are set for EntryLabel.
+	// Token is the version and the fingerprint for EntryFingerprint.
+	Label string
+	Token string
+	// ID and Components are set for EntryComposite.
+	// Components are in order of CompositeIdxLabels.
+	ID         uint64
+	Components []Component
+}
+
+// ParseIndex parses an index built by Indexes or Filters with conf.
+// DefaultConfig is used if conf is nil.
+// Labels and tokens are unescaped with Config.EscapeSeparators.
+func ParseIndex(conf *Config, idx string) (*Entry, error) {
+	if conf == nil {
+		conf = DefaultConfig
+	}
+	conf = conf.withSchemaComposites()
+
+	switch {
+	case idx == IndexNoFilters:
+		return &Entry{Kind: EntryNoFilters}, nil
+	case idx == IndexDegraded:
+		return &Entry{Kind: EntryDegraded}, nil
+	case strings.HasPrefix(idx, IndexFingerprintPrefix):
+		return &Entry{Kind: EntryFingerprint, Token: strings.TrimPrefix(idx, IndexFingerprintPrefix)}, nil
+	}
+
+	i := strings.Index(idx, " ")
+	if i <= 0 {
+		return nil, errors.Errorf("invalid index %q", idx)
+	}
+
+	label, token := idx[:i], idx[i+1:]
+
+	if len(conf.CompositeIdxLabels) <= 1 || !isDigits(label) {
+		label, err := conf.unescape(label)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid label of %q", idx)
+		}
+		token, err := conf.unescape(token)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid token of %q", idx)
+		}
+		return &Entry{Kind: EntryLabel, Label: label, Token: token}, nil
+	}
+
+	id, err := strconv.ParseUint(label, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid composite index %q", idx)
+	}
+	if bits.OnesCount64(id) < 2 || bits.Len64(id) > len(conf.CompositeIdxLabels) {
+		return nil, errors.Errorf("invalid composite index ID %d of %q", id, idx)
+	}
+
+	tokens := strings.Split(token, combiIndexSeperator)
+	if len(tokens) != bits.OnesCount64(id) {
+		return nil, errors.Errorf("%d tokens for %d labels in composite index %q", len(tokens), bits.OnesCount64(id), idx)
+	}
+
+	entry := &Entry{Kind: EntryComposite, ID: id}
+	for pos := 0; id>>uint(pos) != 0; pos++ {
+		if id&(1<<uint(pos)) == 0 {
+			continue
+		}
+		token, err := conf.unescape(tokens[len(entry.Components)])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid token of %q", idx)
+		}
+		entry.Components = append(entry.Components, Component{
+			Label: conf.CompositeIdxLabels[pos],
+			Token: token,
+		})
+	}
+
+	return entry, nil
+}
+
+// ParseIndexes parses indexes built by Indexes or Filters with conf.
+func ParseIndexes(conf *Config, indexes []string) ([]*Entry, error) {
+	entries := make([]*Entry, 0, len(indexes))
+	for _, idx := range indexes {
+		entry, err := ParseIndex(conf, idx)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
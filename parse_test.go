@@ -0,0 +1,91 @@
+package xian
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIndex(t *testing.T) {
+	conf := &Config{CompositeIdxLabels: []string{"s", "c", "p"}}
+
+	for _, tc := range []struct {
+		idx      string
+		expected *Entry
+	}{
+		{"ti ab", &Entry{Kind: EntryLabel, Label: "ti", Token: "ab"}},
+		{"au J. K. Rowling", &Entry{Kind: EntryLabel, Label: "au", Token: "J. K. Rowling"}},
+		{"ti ", &Entry{Kind: EntryLabel, Label: "ti", Token: ""}},
+		{"3 1;sports", &Entry{Kind: EntryComposite, ID: 3, Components: []Component{{"s", "1"}, {"c", "sports"}}}},
+		{"6 sports;p<3000", &Entry{Kind: EntryComposite, ID: 6, Components: []Component{{"c", "sports"}, {"p", "p<3000"}}}},
+		{"7 1;;x", &Entry{Kind: EntryComposite, ID: 7, Components: []Component{{"s", "1"}, {"c", ""}, {"p", "x"}}}},
+		{IndexNoFilters, &Entry{Kind: EntryNoFilters}},
+		{IndexDegraded, &Entry{Kind: EntryDegraded}},
+		{conf.FingerprintIndex(), &Entry{Kind: EntryFingerprint, Token: "1:" + conf.Fingerprint()}},
+	} {
+		t.Run(tc.idx, func(t *testing.T) {
+			entry, err := ParseIndex(conf, tc.idx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(entry, tc.expected) {
+				t.Errorf("unexpected, actual: `%+v`, expected: `%+v`", entry, tc.expected)
+			}
+		})
+	}
+
+	t.Run("複合インデックスがない場合", func(t *testing.T) {
+		entry, err := ParseIndex(nil, "3 a;b")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert(t, "Kind", entry.Kind, EntryLabel)
+		assert(t, "Label", entry.Label, "3")
+	})
+
+	for _, idx := range []string{
+		"",
+		"abc",
+		" abc",
+		"1 a",
+		"8 a;b",
+		"3 a",
+		"3 a;b;c",
+		"99999999999999999999 a;b",
+	} {
+		t.Run("不正な"+idx, func(t *testing.T) {
+			if _, err := ParseIndex(conf, idx); err == nil {
+				t.Error("error = nil, wants != nil")
+			}
+		})
+	}
+}
+
+func TestParseIndexes(t *testing.T) {
+	conf := MustValidateConfig(&Config{
+		CompositeIdxLabels: []string{"s", "c"},
+		SaveNoFiltersIndex: true,
+	})
+
+	built := NewIndexes(conf).Add("s", "1").Add("c", "sports", "cooking").AddBiunigrams("ti", "ab").MustBuild()
+
+	entries, err := ParseIndexes(conf, built)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert(t, "len(entries)", len(entries), len(built))
+
+	kinds := make(map[EntryKind]int)
+	for _, e := range entries {
+		kinds[e.Kind]++
+		if e.Kind == EntryComposite && (e.Components[0].Label != "s" || e.Components[1].Label != "c") {
+			t.Errorf("unexpected components: %+v", e.Components)
+		}
+	}
+	assert(t, "labels", kinds[EntryLabel], 6)
+	assert(t, "composites", kinds[EntryComposite], 2)
+	assert(t, "no filters", kinds[EntryNoFilters], 1)
+
+	if _, err := ParseIndexes(conf, append(built, "invalid")); err == nil {
+		t.Error("error = nil, wants != nil")
+	}
+}
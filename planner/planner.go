@@ -0,0 +1,293 @@
+// Package planner recommends composite index combinations of xian from sample queries.
+//
+// The merge-join width of a query is the number of equality filters,
+// i.e. the number of labels minus labels merged into composite filters.
+// Planner chooses combinations which reduce the total width of sample queries the most
+// for the cost, the expected number of composite indexes per entity,
+// within the budget of indexes per entity.
+package planner
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/knightso/xian"
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxCombinationSize is the default maximum number of labels in a combination.
+const DefaultMaxCombinationSize = 3
+
+// Query is a sample query.
+type Query struct {
+	// Labels is the labels filtered by the query.
+	Labels []string `json:"labels"`
+	// Weight is the relative frequency of the query. 1 is used if it's zero.
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// Options configures Plan.
+type Options struct {
+	// Budget is the maximum number of indexes per entity. xian.MaxIndexesSize is used if it's zero.
+	Budget int `json:"budget,omitempty"`
+	// MaxCombinationSize is the maximum number of labels in a combination.
+	// DefaultMaxCombinationSize is used if it's zero.
+	MaxCombinationSize int `json:"maxCombinationSize,omitempty"`
+	// Base is copied to the planned Config except for composite index fields.
+	Base *xian.Config `json:"-"`
+}
+
+// Combination is a planned combination of labels.
+type Combination struct {
+	// Labels is the labels of the combination.
+	Labels []string `json:"labels"`
+	// Cost is the expected number of composite indexes per entity.
+	Cost float64 `json:"cost"`
+	// Benefit is the reduction of the total width of weighted queries.
+	Benefit float64 `json:"benefit"`
+}
+
+// Result is a result of planning.
+type Result struct {
+	// Config is a configuration with the planned combinations.
+	Config *xian.Config `json:"-"`
+	// Combinations is the planned combinations in order of choice.
+	Combinations []Combination `json:"combinations"`
+	// Indexes is the expected number of indexes per entity.
+	Indexes float64 `json:"indexes"`
+	// Width is the average width of queries before and after the plan.
+	WidthBefore float64 `json:"widthBefore"`
+	WidthAfter  float64 `json:"widthAfter"`
+}
+
+type candidate struct {
+	labels []string // sorted
+	cost   float64
+}
+
+func (c *candidate) key() string {
+	return strings.Join(c.labels, "\x00")
+}
+
+// Plan recommends combinations of labels for queries.
+// cardinalities is the average number of tokens per entity for each label,
+// which can be calculated from xian.Stats.
+func Plan(queries []Query, cardinalities map[string]float64, opts *Options) (*Result, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	budget := float64(opts.Budget)
+	if budget == 0 {
+		budget = xian.MaxIndexesSize
+	}
+	maxSize := opts.MaxCombinationSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxCombinationSize
+	}
+	if maxSize < 2 {
+		return nil, errors.New("MaxCombinationSize must be 2 or more")
+	}
+
+	sets := make([][]string, 0, len(queries))
+	weights := make([]float64, 0, len(queries))
+	var totalWeight float64
+	for _, q := range queries {
+		labels := uniqueSorted(q.Labels)
+		for _, l := range labels {
+			if _, ok := cardinalities[l]; !ok {
+				return nil, errors.Errorf("no cardinality for label %q", l)
+			}
+		}
+		w := q.Weight
+		if w == 0 {
+			w = 1
+		}
+		sets = append(sets, labels)
+		weights = append(weights, w)
+		totalWeight += w
+	}
+
+	// indexes of single labels
+	var used float64
+	for _, n := range cardinalities {
+		used += n
+	}
+	if opts.Base != nil && opts.Base.SaveNoFiltersIndex {
+		used++
+	}
+
+	candidates := makeCandidates(sets, cardinalities, maxSize)
+
+	width := func(chosen []*candidate) float64 {
+		var total float64
+		for i, labels := range sets {
+			total += weights[i] * float64(queryWidth(labels, chosen))
+		}
+		return total
+	}
+
+	var chosen []*candidate
+	plan := &Result{}
+	current := width(nil)
+	if totalWeight > 0 {
+		plan.WidthBefore = current / totalWeight
+	}
+
+	for {
+		var best *candidate
+		var bestScore, bestWidth float64
+		for _, c := range candidates {
+			if c == nil || used+c.cost > budget {
+				continue
+			}
+			w := width(append(chosen[:len(chosen):len(chosen)], c))
+			benefit := current - w
+			if benefit <= 0 {
+				continue
+			}
+			// a combination without composite indexes costs nothing but benefits nothing as well.
+			score := benefit / (c.cost + 1)
+			if best == nil || score > bestScore {
+				best, bestScore, bestWidth = c, score, w
+			}
+		}
+		if best == nil {
+			break
+		}
+
+		plan.Combinations = append(plan.Combinations, Combination{
+			Labels:  best.labels,
+			Cost:    best.cost,
+			Benefit: current - bestWidth,
+		})
+		chosen = append(chosen, best)
+		used += best.cost
+		current = bestWidth
+
+		for i, c := range candidates {
+			if c == best {
+				candidates[i] = nil
+			}
+		}
+	}
+
+	plan.Indexes = used
+	if totalWeight > 0 {
+		plan.WidthAfter = current / totalWeight
+	}
+	conf, err := xian.ValidateConfig(makeConfig(plan.Combinations, opts.Base))
+	if err != nil {
+		return nil, errors.Wrap(err, "planned config")
+	}
+	plan.Config = conf
+
+	return plan, nil
+}
+
+// makeCandidates makes combinations of 2 to maxSize labels in each query.
+func makeCandidates(sets [][]string, cardinalities map[string]float64, maxSize int) []*candidate {
+	seen := make(map[string]bool)
+	var candidates []*candidate
+
+	for _, labels := range sets {
+		var visit func(start int, combi []string)
+		visit = func(start int, combi []string) {
+			if len(combi) >= 2 {
+				c := &candidate{labels: append([]string(nil), combi...), cost: 1}
+				for _, l := range combi {
+					c.cost *= cardinalities[l]
+				}
+				if !seen[c.key()] {
+					seen[c.key()] = true
+					candidates = append(candidates, c)
+				}
+			}
+			if len(combi) == maxSize {
+				return
+			}
+			for i := start; i < len(labels); i++ {
+				visit(i+1, append(combi, labels[i]))
+			}
+		}
+		visit(0, nil)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].key() < candidates[j].key()
+	})
+
+	return candidates
+}
+
+// queryWidth returns the number of filters of a query with labels.
+// Combinations are chosen in the same way as xian.Filters.
+func queryWidth(labels []string, chosen []*candidate) int {
+	set := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		set[l] = true
+	}
+
+	combis := make([]*candidate, 0, len(chosen))
+	for _, c := range chosen {
+		ok := true
+		for _, l := range c.labels {
+			ok = ok && set[l]
+		}
+		if ok {
+			combis = append(combis, c)
+		}
+	}
+	sort.SliceStable(combis, func(i, j int) bool {
+		return len(combis[i].labels) > len(combis[j].labels)
+	})
+
+	width := len(labels)
+	covered := make(map[string]bool)
+	for _, c := range combis {
+		disjoint := true
+		for _, l := range c.labels {
+			disjoint = disjoint && !covered[l]
+		}
+		if !disjoint {
+			continue
+		}
+		for _, l := range c.labels {
+			covered[l] = true
+		}
+		width -= len(c.labels) - 1
+	}
+
+	return width
+}
+
+func makeConfig(combis []Combination, base *xian.Config) *xian.Config {
+	conf := &xian.Config{}
+	if base != nil {
+		*conf = *base
+	}
+	conf.CompositeIdxMaxSize = 0
+	conf.CompositeIdxLabels = nil
+	conf.CompositeIdxCombinations = nil
+
+	var labels []string
+	for _, c := range combis {
+		labels = append(labels, c.Labels...)
+		conf.CompositeIdxCombinations = append(conf.CompositeIdxCombinations, c.Labels)
+	}
+	conf.CompositeIdxLabels = uniqueSorted(labels)
+
+	return conf
+}
+
+func uniqueSorted(labels []string) []string {
+	set := make(map[string]bool, len(labels))
+	unique := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if !set[l] {
+			set[l] = true
+			unique = append(unique, l)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,93 @@
+package planner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/knightso/xian"
+)
+
+func TestPlan(t *testing.T) {
+	queries := []Query{
+		{Labels: []string{"s", "c"}, Weight: 10},
+		{Labels: []string{"c", "s", "p"}},
+		{Labels: []string{"p", "h"}},
+		{Labels: []string{"ti"}},
+	}
+	cardinalities := map[string]float64{"s": 4, "c": 1, "p": 1, "h": 1, "ti": 30}
+
+	result, err := Plan(queries, cardinalities, &Options{Base: &xian.Config{IgnoreCase: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{{"c", "s"}, {"h", "p"}, {"c", "p", "s"}}
+	if !reflect.DeepEqual(result.Config.CompositeIdxCombinations, expected) {
+		t.Errorf("unexpected, actual: `%v`, expected: `%v`", result.Config.CompositeIdxCombinations, expected)
+	}
+	if !result.Config.IgnoreCase {
+		t.Error("IgnoreCase of Base is not copied")
+	}
+	if _, err := xian.ValidateConfig(result.Config); err != nil {
+		t.Errorf("invalid config: %v", err)
+	}
+
+	if result.Indexes != 46 {
+		t.Errorf("Indexes expected:%v, but was:%v", 46, result.Indexes)
+	}
+	if result.WidthBefore != 2 || result.WidthAfter != 1 {
+		t.Errorf("unexpected width before:%v, after:%v", result.WidthBefore, result.WidthAfter)
+	}
+
+	// the planned widths are the same as Filters
+	for _, q := range queries {
+		filters := xian.NewFilters(result.Config)
+		for _, l := range q.Labels {
+			filters.Add(l, "x")
+		}
+		if n := len(filters.MustBuild()); n != 1 {
+			t.Errorf("%v: len(filters) expected:%d, but was:%d", q.Labels, 1, n)
+		}
+	}
+}
+
+func TestPlanBudget(t *testing.T) {
+	queries := []Query{
+		{Labels: []string{"a", "b"}, Weight: 1},
+		{Labels: []string{"a", "c"}, Weight: 2},
+	}
+	cardinalities := map[string]float64{"a": 10, "b": 10, "c": 20}
+
+	result, err := Plan(queries, cardinalities, &Options{Budget: 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// {a, c} costs 200 over the budget.
+	expected := [][]string{{"a", "b"}}
+	if !reflect.DeepEqual(result.Config.CompositeIdxCombinations, expected) {
+		t.Errorf("unexpected, actual: `%v`, expected: `%v`", result.Config.CompositeIdxCombinations, expected)
+	}
+	if result.Indexes > 150 {
+		t.Errorf("Indexes exceeds the budget: %v", result.Indexes)
+	}
+}
+
+func TestPlanError(t *testing.T) {
+	if _, err := Plan([]Query{{Labels: []string{"a", "b"}}}, map[string]float64{"a": 1}, nil); err == nil {
+		t.Error("error = nil, wants != nil")
+	}
+	if _, err := Plan(nil, nil, &Options{MaxCombinationSize: 1}); err == nil {
+		t.Error("error = nil, wants != nil")
+	}
+
+	// the planned config is validated.
+	queries := []Query{{Labels: []string{"a b", "c"}}}
+	cardinalities := map[string]float64{"a b": 1, "c": 1}
+	if _, err := Plan(queries, cardinalities, nil); err == nil {
+		t.Error("error = nil, wants != nil")
+	}
+	if _, err := Plan(queries, cardinalities, &Options{Base: &xian.Config{EscapeSeparators: true}}); err != nil {
+		t.Errorf("error = %v, wants = nil", err)
+	}
+}
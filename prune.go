@@ -0,0 +1,44 @@
+package xian
+
+// TokenSelector chooses tokens to filter with from partial match tokens of a label.
+type TokenSelector interface {
+	// SelectTokens returns at most max tokens from tokens.
+	// tokens are in order of appearance in the query.
+	SelectTokens(label string, tokens []string, max int) []string
+}
+
+// TokenSelectorFunc is an adapter to use a function as TokenSelector.
+type TokenSelectorFunc func(label string, tokens []string, max int) []string
+
+// SelectTokens calls f(label, tokens, max).
+func (f TokenSelectorFunc) SelectTokens(label string, tokens []string, max int) []string {
+	return f(label, tokens, max)
+}
+
+// EvenlySpacedTokens selects tokens at even intervals including the first and the last ones.
+// The selected bigrams spread over the whole query.
+var EvenlySpacedTokens TokenSelector = TokenSelectorFunc(selectEvenlySpaced)
+
+func selectEvenlySpaced(label string, tokens []string, max int) []string {
+	if len(tokens) <= max {
+		return tokens
+	}
+	if max == 1 {
+		return tokens[:1]
+	}
+
+	selected := make([]string, 0, max)
+	for i := 0; i < max; i++ {
+		selected = append(selected, tokens[i*(len(tokens)-1)/(max-1)])
+	}
+	return selected
+}
+
+func containsToken(tokens []string, token string) bool {
+	for _, t := range tokens {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
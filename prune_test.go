@@ -0,0 +1,96 @@
+package xian
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvenlySpacedTokens(t *testing.T) {
+	tokens := []string{"ab", "bc", "cd", "de", "ef", "fg", "gh"}
+
+	for _, tc := range []struct {
+		max      int
+		expected []string
+	}{
+		{1, []string{"ab"}},
+		{2, []string{"ab", "gh"}},
+		{3, []string{"ab", "de", "gh"}},
+		{4, []string{"ab", "cd", "ef", "gh"}},
+		{7, tokens},
+		{8, tokens},
+	} {
+		selected := EvenlySpacedTokens.SelectTokens("label", tokens, tc.max)
+		if !reflect.DeepEqual(selected, tc.expected) {
+			t.Errorf("max=%d unexpected, actual: `%v`, expected: `%v`", tc.max, selected, tc.expected)
+		}
+	}
+}
+
+func TestLimitPartialFilters(t *testing.T) {
+	t.Run("上限以下の場合", func(t *testing.T) {
+		filters := NewFilters(nil).AddBiunigrams("ti", "abcd").LimitPartialFilters(3, nil)
+
+		assertBuiltFilter(t, filters.MustBuild(), []string{"ti ab", "ti bc", "ti cd"})
+		if pruned := filters.PrunedTokens(); len(pruned) != 0 {
+			t.Errorf("unexpected pruned tokens: %v", pruned)
+		}
+	})
+
+	t.Run("上限を超える場合", func(t *testing.T) {
+		filters := NewFilters(&Config{IgnoreCase: true}).
+			AddBiunigrams("ti", "ABCDEFGH").
+			Add("s", "1").
+			LimitPartialFilters(3, nil)
+
+		assertBuiltFilter(t, filters.MustBuild(), []string{"s 1", "ti ab", "ti de", "ti gh"})
+		expected := map[string][]string{"ti": {"bc", "cd", "ef", "fg"}}
+		if pruned := filters.PrunedTokens(); !reflect.DeepEqual(pruned, expected) {
+			t.Errorf("unexpected, actual: `%v`, expected: `%v`", pruned, expected)
+		}
+
+		// pruned conditions are still verified by Matcher.
+		m := filters.Matcher()
+		assert(t, "match", m.Match(Values{"ti": {"abcdefgh"}}), true)
+		assert(t, "false positive", m.Match(Values{"ti": {"abxdexgh"}}), false)
+	})
+
+	t.Run("TokenSelectorを指定した場合", func(t *testing.T) {
+		selector := TokenSelectorFunc(func(label string, tokens []string, max int) []string {
+			return tokens[len(tokens)-max:]
+		})
+		filters := NewFilters(nil).AddBiunigrams("ti", "abcdef").LimitPartialFilters(2, selector)
+
+		assertBuiltFilter(t, filters.MustBuild(), []string{"ti de", "ti ef"})
+	})
+
+	t.Run("同じラベルに完全一致のフィルタがある場合", func(t *testing.T) {
+		filters := NewFilters(nil).
+			Add("ti", "cd").
+			AddBiunigrams("ti", "abcdef").
+			LimitPartialFilters(2, nil)
+
+		assertBuiltFilter(t, filters.MustBuild(), []string{"ti ab", "ti cd", "ti ef"})
+		expected := map[string][]string{"ti": {"bc", "de"}}
+		if pruned := filters.PrunedTokens(); !reflect.DeepEqual(pruned, expected) {
+			t.Errorf("unexpected, actual: `%v`, expected: `%v`", pruned, expected)
+		}
+	})
+
+	t.Run("CompositeIdxLabelsの場合", func(t *testing.T) {
+		conf := &Config{CompositeIdxLabels: []string{"ti", "s"}}
+		filters := NewFilters(conf).
+			AddBiunigrams("ti", "abcd").
+			Add("s", "1").
+			LimitPartialFilters(1, nil)
+
+		built := filters.MustBuild()
+		assertBuiltFilter(t, built, []string{"3 ab;1"})
+
+		idxs := NewIndexes(conf).AddBiunigrams("ti", "abcd").Add("s", "1").MustBuild()
+		for _, f := range built {
+			if !containsString(idxs, f) {
+				t.Errorf("filter: %s not contains", f)
+			}
+		}
+	})
+}
@@ -0,0 +1,246 @@
+package query
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	wildcard       = '*'
+	rangeSeparator = ".."
+	orOperator     = "OR"
+)
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) syntaxError(pos int, msg string) error {
+	return &ParseError{Pos: pos, Err: ErrSyntax, Msg: msg}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) peek() rune {
+	r, _ := utf8.DecodeRuneInString(p.s[p.pos:])
+	return r
+}
+
+func (p *parser) skipSpaces() {
+	for !p.eof() && isSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *parser) parse() ([]*Clause, error) {
+	var clauses []*Clause
+
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			return clauses, nil
+		}
+
+		c, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, c)
+	}
+}
+
+func (p *parser) parseClause() (*Clause, error) {
+	c := &Clause{Pos: p.pos}
+
+	if p.peek() == '-' {
+		c.Negate = true
+		p.pos++
+	}
+
+	// field name
+	if end := p.scanWord(true); end < len(p.s) && p.s[end] == ':' && end > p.pos {
+		c.Field = p.s[p.pos:end]
+		p.pos = end + 1
+	}
+
+	if p.eof() || isSpace(p.peek()) {
+		return nil, p.syntaxError(p.pos, "missing value")
+	}
+
+	switch p.peek() {
+	case '(':
+		terms, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		c.Terms = terms
+	default:
+		start := p.pos
+		if p.peek() != '"' {
+			end := p.scanWord(false)
+			if i := strings.Index(p.s[start:end], rangeSeparator); i >= 0 {
+				c.Range = &Range{
+					From: p.s[start : start+i],
+					To:   p.s[start+i+len(rangeSeparator) : end],
+				}
+				if c.Range.From == "" && c.Range.To == "" {
+					return nil, p.syntaxError(start, "empty range")
+				}
+				p.pos = end
+				break
+			}
+		}
+		t, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		c.Terms = []*Term{t}
+	}
+
+	if !p.eof() && !isSpace(p.peek()) {
+		return nil, p.syntaxError(p.pos, "unexpected character")
+	}
+
+	return c, nil
+}
+
+// parseList parses `(term OR term ...)`.
+func (p *parser) parseList() ([]*Term, error) {
+	start := p.pos
+	p.pos++ // '('
+
+	var terms []*Term
+
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			return nil, p.syntaxError(start, "unclosed parenthesis")
+		}
+
+		if p.peek() == ')' {
+			if len(terms) == 0 {
+				return nil, p.syntaxError(p.pos, "empty list")
+			}
+			p.pos++
+			return terms, nil
+		}
+
+		if len(terms) > 0 {
+			opPos := p.pos
+			end := p.scanWord(false)
+			if p.s[opPos:end] != orOperator {
+				return nil, p.syntaxError(opPos, "OR expected")
+			}
+			p.pos = end
+			p.skipSpaces()
+			if p.eof() || p.peek() == ')' {
+				return nil, p.syntaxError(p.pos, "missing value")
+			}
+		}
+
+		t, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+	}
+}
+
+// parseTerm parses a bare term or a quoted phrase with wildcards.
+func (p *parser) parseTerm() (*Term, error) {
+	t := &Term{Pos: p.pos}
+
+	if p.peek() == wildcard {
+		t.Suffix = true
+		p.pos++
+	}
+
+	if !p.eof() && p.peek() == '"' {
+		value, prefix, suffix, err := p.scanPhrase()
+		if err != nil {
+			return nil, err
+		}
+		t.Phrase = true
+		t.Value = value
+		t.Prefix = prefix
+		t.Suffix = t.Suffix || suffix
+		if !p.eof() && p.peek() == wildcard {
+			t.Prefix = true
+			p.pos++
+		}
+	} else {
+		end := p.scanWord(false)
+		value := p.s[p.pos:end]
+		p.pos = end
+		if strings.HasSuffix(value, string(wildcard)) {
+			t.Prefix = true
+			value = value[:len(value)-1]
+		}
+		t.Value = value
+	}
+
+	if t.Value == "" {
+		return nil, p.syntaxError(t.Pos, "empty term")
+	}
+
+	return t, nil
+}
+
+// scanPhrase scans a quoted phrase and returns unquoted value.
+// A backslash escapes the following character.
+// Unescaped wildcards at the end or the beginning of the phrase such as "harry po*"
+// are reported as prefix or suffix.
+func (p *parser) scanPhrase() (value string, prefix, suffix bool, err error) {
+	start := p.pos
+	p.pos++ // '"'
+
+	var b strings.Builder
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		p.pos += size
+
+		switch r {
+		case '"':
+			return b.String(), prefix, suffix, nil
+		case '\\':
+			if p.eof() {
+				return "", false, false, p.syntaxError(p.pos, "unterminated escape")
+			}
+			r, size = utf8.DecodeRuneInString(p.s[p.pos:])
+			p.pos += size
+		case wildcard:
+			if b.Len() == 0 && !suffix {
+				suffix = true
+				continue
+			}
+			if p.pos < len(p.s) && p.s[p.pos] == '"' {
+				prefix = true
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+
+	return "", false, false, p.syntaxError(start, "unclosed quote")
+}
+
+// scanWord returns the end offset of a bare word from the current position.
+// stopAtColon is used to scan a field name.
+func (p *parser) scanWord(stopAtColon bool) int {
+	end := p.pos
+	for end < len(p.s) {
+		r, size := utf8.DecodeRuneInString(p.s[end:])
+		if isSpace(r) || r == '(' || r == ')' || r == '"' || (stopAtColon && r == ':') {
+			break
+		}
+		end += size
+	}
+	return end
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
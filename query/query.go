@@ -0,0 +1,393 @@
+// Package query parses a user-facing search syntax into xian Filters.
+//
+// A query is a sequence of whitespace separated clauses.
+//
+//	title:"harry po*" status:(published OR unpublished) -tag:draft price:1000..5000
+//
+// Each clause is an optional '-' for negation, an optional field name followed by ':'
+// and a value. A value is a bare term, a quoted phrase, a parenthesized list of terms
+// separated by OR, or a range `from..to`.
+// A leading or trailing '*' of a term requests a suffix or prefix match.
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/knightso/xian"
+	"github.com/pkg/errors"
+)
+
+// Kind describes how terms of a field are matched.
+type Kind int
+
+const (
+	// Exact matches whole values with Filters.Add.
+	Exact Kind = iota
+	// Partial matches substrings with Filters.AddBiunigrams.
+	Partial
+	// Prefix matches word prefixes with Filters.AddPrefix.
+	Prefix
+	// Suffix matches word suffixes with Filters.AddSuffix.
+	Suffix
+	// In matches any of named values with InBuilder.Filter.
+	In
+)
+
+// Field describes how a query field is mapped to labels.
+type Field struct {
+	// Label is the label for terms without wildcards.
+	Label string
+	// Kind is the matching kind for terms without wildcards.
+	Kind Kind
+	// PrefixLabel is the label for terms like `term*`. It must be indexed with AddPrefixes.
+	PrefixLabel string
+	// SuffixLabel is the label for terms like `*term`. It must be indexed with AddSuffixes.
+	SuffixLabel string
+	// InBuilder creates filters for In fields.
+	InBuilder *xian.InBuilder
+	// Values maps values of In fields to bits.
+	// Named bits of InBuilder are used if it's nil.
+	Values map[string]xian.Bit
+	// Range converts a range `from..to` into a filter token of Label.
+	// Either from or to can be empty for open ranges.
+	Range func(from, to string) (string, error)
+}
+
+// Schema maps field names to fields.
+// The field with an empty name is used for terms without a field name.
+type Schema map[string]*Field
+
+// Errors reported by Parse wrapped in *ParseError.
+var (
+	ErrSyntax       = errors.New("syntax error")
+	ErrUnknownField = errors.New("unknown field")
+	ErrUnknownValue = errors.New("unknown value")
+	ErrUnsupported  = errors.New("unsupported by field")
+)
+
+// ParseError describes a failure of Parse.
+type ParseError struct {
+	// Pos is the byte offset in the query where the error occurred.
+	Pos int
+	// Field is the field name of the clause if any.
+	Field string
+	// Err is one of ErrSyntax, ErrUnknownField, ErrUnknownValue, ErrUnsupported
+	// or an error returned by Field.Range.
+	Err error
+	// Msg describes details of the error.
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	msg := e.Err.Error()
+	if e.Msg != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Msg)
+	}
+	if e.Field != "" {
+		msg = fmt.Sprintf("%s: %s", e.Field, msg)
+	}
+	return fmt.Sprintf("query: %s at position %d", msg, e.Pos)
+}
+
+// Cause returns the underlying error.
+func (e *ParseError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Term is a single value in a clause.
+type Term struct {
+	// Pos is the byte offset of the term in the query.
+	Pos int
+	// Value is the term without quotes and wildcards.
+	Value string
+	// Phrase reports whether the term was quoted.
+	Phrase bool
+	// Prefix reports whether the term had a trailing '*'.
+	Prefix bool
+	// Suffix reports whether the term had a leading '*'.
+	Suffix bool
+}
+
+// Range is a range value of a clause.
+type Range struct {
+	From, To string
+}
+
+// Clause is a parsed clause of a query.
+type Clause struct {
+	// Pos is the byte offset of the clause in the query.
+	Pos int
+	// Field is the field name. It's empty for the default field.
+	Field string
+	// Negate reports whether the clause was prefixed with '-'.
+	Negate bool
+	// Terms are the terms of the clause combined with OR.
+	Terms []*Term
+	// Range is set for range clauses.
+	Range *Range
+
+	filters      []filter
+	alternatives *alternatives
+}
+
+type filterKind int
+
+const (
+	filterAdd filterKind = iota
+	filterBiunigrams
+	filterPrefix
+	filterSuffix
+)
+
+type filter struct {
+	kind  filterKind
+	label string
+	value string
+}
+
+// alternatives are filters of an In clause whose values span groups of InBuilder.
+type alternatives struct {
+	label  string
+	values []string
+}
+
+// Query is a parsed query.
+type Query struct {
+	// Clauses are the clauses in order of appearance.
+	Clauses []*Clause
+}
+
+// Apply adds filters of q to filters.
+// Negated clauses of fields other than In can't be expressed by equality filters,
+// so that they are not applied. Use Negations to filter them out of results.
+// In clauses whose values span groups of InBuilder are not applied either. Use Alternatives for them.
+func (q *Query) Apply(filters *xian.Filters) *xian.Filters {
+	for _, c := range q.Clauses {
+		for _, f := range c.filters {
+			switch f.kind {
+			case filterAdd:
+				filters.Add(f.label, f.value)
+			case filterBiunigrams:
+				filters.AddBiunigrams(f.label, f.value)
+			case filterPrefix:
+				filters.AddPrefix(f.label, f.value)
+			case filterSuffix:
+				// suffix tokens are reversed words.
+				filters.AddSuffix(f.label, xian.ReverseSuffix(f.value))
+			}
+		}
+	}
+	return filters
+}
+
+// Alternatives adds filters of q to filters and returns a copy of them for each combination of
+// alternative filters of In clauses whose values span groups of InBuilder.
+// It returns only filters if q has no such clauses.
+// Each alternative needs its own query and the results should be merged.
+func (q *Query) Alternatives(filters *xian.Filters) []*xian.Filters {
+	alts := []*xian.Filters{q.Apply(filters)}
+	for _, c := range q.Clauses {
+		if c.alternatives == nil {
+			continue
+		}
+		next := make([]*xian.Filters, 0, len(alts)*len(c.alternatives.values))
+		for _, alt := range alts {
+			next = append(next, alt.Alternatives(c.alternatives.label, c.alternatives.values...)...)
+		}
+		alts = next
+	}
+	return alts
+}
+
+// Negations returns negated clauses which are not applied by Apply.
+func (q *Query) Negations() []*Clause {
+	var negations []*Clause
+	for _, c := range q.Clauses {
+		if c.Negate && len(c.filters) == 0 && c.alternatives == nil {
+			negations = append(negations, c)
+		}
+	}
+	return negations
+}
+
+// Parse parses s with schema.
+// A returned error is always *ParseError.
+func Parse(s string, schema Schema) (*Query, error) {
+	p := &parser{s: s}
+
+	clauses, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range clauses {
+		if err := resolve(c, schema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Query{Clauses: clauses}, nil
+}
+
+// MustParse parses s with schema and panics with error.
+func MustParse(s string, schema Schema) *Query {
+	q, err := Parse(s, schema)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// resolve converts c into filters with the field definition.
+func resolve(c *Clause, schema Schema) error {
+	field, ok := schema[c.Field]
+	if !ok {
+		if c.Field == "" {
+			return &ParseError{Pos: c.Pos, Err: ErrUnknownField, Msg: "no default field"}
+		}
+		return &ParseError{Pos: c.Pos, Field: c.Field, Err: ErrUnknownField}
+	}
+
+	unsupported := func(pos int, msg string) error {
+		return &ParseError{Pos: pos, Field: c.Field, Err: ErrUnsupported, Msg: msg}
+	}
+
+	if c.Range != nil {
+		if field.Range == nil {
+			return unsupported(c.Pos, "range")
+		}
+		if c.Negate {
+			return unsupported(c.Pos, "negated range")
+		}
+		token, err := field.Range(c.Range.From, c.Range.To)
+		if err != nil {
+			return &ParseError{Pos: c.Pos, Field: c.Field, Err: err}
+		}
+		c.filters = append(c.filters, filter{filterAdd, field.Label, token})
+		return nil
+	}
+
+	if field.Kind == In {
+		return resolveIn(c, field)
+	}
+
+	if len(c.Terms) > 1 {
+		return unsupported(c.Terms[1].Pos, "OR")
+	}
+	if c.Negate {
+		// can't be expressed with equality filters.
+		return nil
+	}
+
+	t := c.Terms[0]
+
+	switch {
+	case t.Prefix && t.Suffix:
+		if field.Kind != Partial {
+			return unsupported(t.Pos, "contains match")
+		}
+		c.filters = append(c.filters, filter{filterBiunigrams, field.Label, t.Value})
+	case t.Prefix:
+		switch {
+		case field.PrefixLabel != "":
+			c.filters = appendWords(c.filters, filterPrefix, field.PrefixLabel, t.Value)
+		case field.Kind == Prefix:
+			c.filters = appendWords(c.filters, filterPrefix, field.Label, t.Value)
+		case field.Kind == Partial:
+			// partial match is looser than prefix match.
+			c.filters = append(c.filters, filter{filterBiunigrams, field.Label, t.Value})
+		default:
+			return unsupported(t.Pos, "prefix match")
+		}
+	case t.Suffix:
+		switch {
+		case field.SuffixLabel != "":
+			c.filters = appendWords(c.filters, filterSuffix, field.SuffixLabel, t.Value)
+		case field.Kind == Suffix:
+			c.filters = appendWords(c.filters, filterSuffix, field.Label, t.Value)
+		case field.Kind == Partial:
+			// partial match is looser than suffix match.
+			c.filters = append(c.filters, filter{filterBiunigrams, field.Label, t.Value})
+		default:
+			return unsupported(t.Pos, "suffix match")
+		}
+	default:
+		switch field.Kind {
+		case Exact:
+			c.filters = append(c.filters, filter{filterAdd, field.Label, t.Value})
+		case Partial:
+			c.filters = append(c.filters, filter{filterBiunigrams, field.Label, t.Value})
+		case Prefix:
+			c.filters = appendWords(c.filters, filterPrefix, field.Label, t.Value)
+		case Suffix:
+			c.filters = appendWords(c.filters, filterSuffix, field.Label, t.Value)
+		default:
+			return unsupported(t.Pos, fmt.Sprintf("kind %d", field.Kind))
+		}
+	}
+
+	return nil
+}
+
+func resolveIn(c *Clause, field *Field) error {
+	if field.InBuilder == nil {
+		return &ParseError{Pos: c.Pos, Field: c.Field, Err: ErrUnsupported, Msg: "no InBuilder"}
+	}
+
+	values := field.Values
+	if values == nil {
+		values = field.InBuilder.NamedBits()
+	}
+
+	selected := make(map[string]struct{})
+	for _, t := range c.Terms {
+		if t.Prefix || t.Suffix {
+			return &ParseError{Pos: t.Pos, Field: c.Field, Err: ErrUnsupported, Msg: "wildcard"}
+		}
+		if _, ok := values[t.Value]; !ok {
+			return &ParseError{Pos: t.Pos, Field: c.Field, Err: ErrUnknownValue, Msg: t.Value}
+		}
+		selected[t.Value] = struct{}{}
+	}
+
+	var bits []xian.Bit
+	for v, bit := range values {
+		if _, ok := selected[v]; ok != c.Negate {
+			bits = append(bits, bit)
+		}
+	}
+
+	if len(bits) == 0 {
+		// negation of all values never matches. filter with an empty set.
+		c.filters = append(c.filters, filter{filterAdd, field.Label, field.InBuilder.Filter()})
+		return nil
+	}
+
+	filterSets := field.InBuilder.FilterSets(bits...)
+	if len(filterSets) > 1 {
+		// a filter can't combine bits of different groups.
+		c.alternatives = &alternatives{field.Label, filterSets}
+		return nil
+	}
+
+	c.filters = append(c.filters, filter{filterAdd, field.Label, filterSets[0]})
+	return nil
+}
+
+// appendWords appends a filter for each word in s
+// since prefix and suffix indexes are created for each word.
+func appendWords(filters []filter, kind filterKind, label, s string) []filter {
+	for _, w := range strings.Split(s, " ") {
+		if w == "" {
+			continue
+		}
+		filters = append(filters, filter{kind, label, w})
+	}
+	return filters
+}
@@ -0,0 +1,302 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/knightso/xian"
+	"github.com/pkg/errors"
+)
+
+func newTestSchema() (Schema, *xian.InBuilder, map[string]xian.Bit) {
+	inBuilder := xian.NewInBuilder()
+	statuses := map[string]xian.Bit{
+		"unpublished":  inBuilder.NewBit(),
+		"published":    inBuilder.NewBit(),
+		"discontinued": inBuilder.NewBit(),
+	}
+
+	schema := Schema{
+		"": {Label: "ti", Kind: Partial},
+		"title": {
+			Label:       "ti",
+			Kind:        Partial,
+			PrefixLabel: "tp",
+			SuffixLabel: "ts",
+		},
+		"author": {Label: "au", Kind: Exact},
+		"tag":    {Label: "tg", Kind: Exact},
+		"status": {
+			Label:     "s",
+			Kind:      In,
+			InBuilder: inBuilder,
+			Values:    statuses,
+		},
+		"price": {
+			Label: "pr",
+			Kind:  Exact,
+			Range: func(from, to string) (string, error) {
+				if from == "" || to == "" {
+					return "", errors.New("open range")
+				}
+				return fmt.Sprintf("%s<=p<%s", from, to), nil
+			},
+		},
+	}
+
+	return schema, inBuilder, statuses
+}
+
+func TestParse(t *testing.T) {
+	schema, inBuilder, statuses := newTestSchema()
+
+	q, err := Parse(`title:"harry po*" status:(published OR unpublished) -tag:draft price:1000..5000 author:rowling`, schema)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(q.Clauses) != 5 {
+		t.Fatalf("len(q.Clauses) expected:%d, but was:%d", 5, len(q.Clauses))
+	}
+
+	built := q.Apply(xian.NewFilters(nil)).MustBuild()
+
+	expected := []string{
+		"tp harry",
+		"tp po",
+		"s " + inBuilder.Filter(statuses["published"], statuses["unpublished"]),
+		"pr 1000<=p<5000",
+		"au rowling",
+	}
+	assertStrings(t, built, expected)
+
+	negations := q.Negations()
+	if len(negations) != 1 {
+		t.Fatalf("len(negations) expected:%d, but was:%d", 1, len(negations))
+	}
+	if negations[0].Field != "tag" || negations[0].Terms[0].Value != "draft" {
+		t.Errorf("unexpected negation: %#v", negations[0])
+	}
+}
+
+func TestParseTerms(t *testing.T) {
+	schema, inBuilder, statuses := newTestSchema()
+
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		{`abc`, xian.NewFilters(nil).AddBiunigrams("ti", "abc").MustBuild()},
+		{`title:abc`, xian.NewFilters(nil).AddBiunigrams("ti", "abc").MustBuild()},
+		{`title:abc*`, []string{"tp abc"}},
+		{`title:*abc`, []string{"ts cba"}},
+		{`title:*abc*`, xian.NewFilters(nil).AddBiunigrams("ti", "abc").MustBuild()},
+		{`title:"a \"b\" c"`, xian.NewFilters(nil).AddBiunigrams("ti", `a "b" c`).MustBuild()},
+		{`title:"2\*"`, xian.NewFilters(nil).AddBiunigrams("ti", "2*").MustBuild()},
+		{`author:"J. K. Rowling"`, []string{"au J. K. Rowling"}},
+		{`-status:published`, []string{"s " + inBuilder.Filter(statuses["unpublished"], statuses["discontinued"])}},
+		{`author:a:b`, []string{"au a:b"}},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			q, err := Parse(tc.query, schema)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertStrings(t, q.Apply(xian.NewFilters(nil)).MustBuild(), tc.expected)
+		})
+	}
+}
+
+func TestParseSuffix(t *testing.T) {
+	schema, _, _ := newTestSchema()
+	conf := &xian.Config{IgnoreCase: true}
+	idxs := xian.NewIndexes(conf).AddSuffixes("ts", "Harry Potter").MustBuild()
+
+	for _, query := range []string{`title:*ter`, `title:*Potter`} {
+		t.Run(query, func(t *testing.T) {
+			q, err := Parse(query, schema)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			filters := q.Apply(xian.NewFilters(conf))
+			for _, f := range filters.MustBuild() {
+				if !containsString(idxs, f) {
+					t.Errorf("filter: %s not contains", f)
+				}
+			}
+			if !filters.Matcher().Match(xian.Values{"ts": {"Harry Potter"}}) {
+				t.Error("Matcher doesn't match")
+			}
+		})
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseError(t *testing.T) {
+	schema, _, _ := newTestSchema()
+
+	for _, tc := range []struct {
+		query string
+		err   error
+		pos   int
+	}{
+		{`title:"abc`, ErrSyntax, 6},
+		{`title:`, ErrSyntax, 6},
+		{`status:(published unpublished)`, ErrSyntax, 18},
+		{`status:(published OR )`, ErrSyntax, 21},
+		{`status:()`, ErrSyntax, 8},
+		{`status:(published`, ErrSyntax, 7},
+		{`title:abc)`, ErrSyntax, 9},
+		{`price:..`, ErrSyntax, 6},
+		{`isbn:123`, ErrUnknownField, 0},
+		{`abc -isbn:123`, ErrUnknownField, 4},
+		{`status:(published OR sold)`, ErrUnknownValue, 21},
+		{`author:(a OR b)`, ErrUnsupported, 13},
+		{`author:abc*`, ErrUnsupported, 7},
+		{`title:1..2`, ErrUnsupported, 0},
+		{`status:publ*`, ErrUnsupported, 7},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			_, err := Parse(tc.query, schema)
+			if err == nil {
+				t.Fatal("error = nil, wants != nil")
+			}
+
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("unexpected error type: %T", err)
+			}
+			if perr.Err != tc.err {
+				t.Errorf("err expected:%v, but was:%v", tc.err, perr.Err)
+			}
+			if perr.Pos != tc.pos {
+				t.Errorf("pos expected:%d, but was:%d", tc.pos, perr.Pos)
+			}
+			if errors.Cause(err) != tc.err {
+				t.Errorf("errors.Cause(err) expected:%v, but was:%v", tc.err, errors.Cause(err))
+			}
+		})
+	}
+
+	t.Run("Rangeのエラー", func(t *testing.T) {
+		_, err := Parse(`price:1000..`, schema)
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("unexpected error type: %T", err)
+		}
+		if perr.Field != "price" || perr.Err.Error() != "open range" {
+			t.Errorf("unexpected error: %v", perr)
+		}
+	})
+
+	t.Run("デフォルトフィールドがない場合", func(t *testing.T) {
+		delete(schema, "")
+		_, err := Parse(`title:abc def`, schema)
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("unexpected error type: %T", err)
+		}
+		if perr.Err != ErrUnknownField || perr.Pos != 10 {
+			t.Errorf("unexpected error: %v", perr)
+		}
+	})
+}
+
+func assertStrings(t *testing.T, actual, expected []string) {
+	t.Helper()
+
+	actual = append([]string(nil), actual...)
+	expected = append([]string(nil), expected...)
+	sort.Strings(actual)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected, actual: `%v`, expected: `%v`", actual, expected)
+	}
+}
+
+func TestParseNamedBits(t *testing.T) {
+	inBuilder := xian.NewInBuilder()
+	published := inBuilder.MustNewBitNamed("published", 0)
+	unpublished := inBuilder.MustNewBitNamed("unpublished", 1)
+	inBuilder.MustNewBitNamed("discontinued", 2)
+
+	schema := Schema{
+		"status": {Label: "s", Kind: In, InBuilder: inBuilder},
+	}
+
+	q, err := Parse(`-status:discontinued`, schema)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertStrings(t, q.Apply(xian.NewFilters(nil)).MustBuild(), []string{"s " + inBuilder.Filter(published, unpublished)})
+
+	if _, err := Parse(`status:sold`, schema); errors.Cause(err) != ErrUnknownValue {
+		t.Errorf("err expected:%v, but was:%v", ErrUnknownValue, err)
+	}
+}
+
+func TestParseAlternatives(t *testing.T) {
+	inBuilder := xian.NewInBuilderWithConfig(&xian.InConfig{GroupSize: 2})
+	a := inBuilder.MustNewBitNamed("a", 0)
+	b := inBuilder.MustNewBitNamed("b", 1)
+	c := inBuilder.MustNewBitNamed("c", 2)
+
+	schema := Schema{
+		"author": {Label: "au", Kind: Exact},
+		"status": {Label: "s", Kind: In, InBuilder: inBuilder},
+	}
+
+	for _, tc := range []struct {
+		query    string
+		expected [][]string
+	}{
+		{`status:(a OR c)`, [][]string{
+			{"s " + inBuilder.Filter(a)},
+			{"s " + inBuilder.Filter(c)},
+		}},
+		{`-status:b author:rowling`, [][]string{
+			{"s " + inBuilder.Filter(a), "au rowling"},
+			{"s " + inBuilder.Filter(c), "au rowling"},
+		}},
+		{`status:(a OR b)`, [][]string{
+			{"s " + inBuilder.Filter(a, b)},
+		}},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			q, err := Parse(tc.query, schema)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			alts := q.Alternatives(xian.NewFilters(nil))
+			if len(alts) != len(tc.expected) {
+				t.Fatalf("len(alts) expected:%d, but was:%d", len(tc.expected), len(alts))
+			}
+			for i, alt := range alts {
+				assertStrings(t, alt.MustBuild(), tc.expected[i])
+			}
+
+			if len(q.Negations()) != 0 {
+				t.Errorf("unexpected negations: %v", q.Negations())
+			}
+		})
+	}
+
+	t.Run("複数の節の組み合わせ", func(t *testing.T) {
+		q := MustParse(`status:(a OR c) -status:b`, schema)
+		alts := q.Alternatives(xian.NewFilters(nil))
+		if len(alts) != 4 {
+			t.Fatalf("len(alts) expected:%d, but was:%d", 4, len(alts))
+		}
+		assertStrings(t, alts[1].MustBuild(), []string{"s " + inBuilder.Filter(a), "s " + inBuilder.Filter(c)})
+	})
+}
@@ -0,0 +1,196 @@
+package xian
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// LabelKind is a tokenizer kind of a label.
+type LabelKind int
+
+const (
+	// LabelExact is a label for Add and AddSomething.
+	LabelExact LabelKind = iota + 1
+	// LabelPartial is a label for AddBigrams and AddBiunigrams.
+	LabelPartial
+	// LabelPrefix is a label for Indexes.AddPrefixes and Filters.AddPrefix.
+	LabelPrefix
+	// LabelSuffix is a label for Indexes.AddSuffixes and Filters.AddSuffix.
+	LabelSuffix
+)
+
+func (k LabelKind) String() string {
+	if name, ok := labelKindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Normalization is a normalization of tokens of a label.
+type Normalization int
+
+const (
+	// NormalizeDefault follows Config.IgnoreCase.
+	NormalizeDefault Normalization = iota
+	// NormalizeNone keeps tokens as they are.
+	NormalizeNone
+	// NormalizeLowerCase converts tokens to lower case.
+	NormalizeLowerCase
+)
+
+// LabelSchema declares a label.
+type LabelSchema struct {
+	// Name is the label.
+	Name string `json:"name" yaml:"name"`
+	// Kind is the tokenizer kind of the label.
+	Kind LabelKind `json:"kind" yaml:"kind"`
+	// Normalization is the normalization of tokens of the label.
+	Normalization Normalization `json:"normalization,omitempty" yaml:"normalization,omitempty"`
+	// Composite defines whether the label is in composite indexes.
+	Composite bool `json:"composite,omitempty" yaml:"composite,omitempty"`
+	// InBuilder is the bit assignment of an IN label. Kind must be LabelExact.
+	InBuilder *InBuilder `json:"in,omitempty" yaml:"in,omitempty"`
+}
+
+// Schema declares labels shared by Indexes and Filters.
+// Indexes and Filters with Schema reject undeclared labels and operations
+// which don't match the kind of the label, and Build returns the first error.
+type Schema struct {
+	labels []*LabelSchema
+	m      map[string]*LabelSchema
+}
+
+// NewSchema creates Schema of labels.
+func NewSchema(labels ...*LabelSchema) (*Schema, error) {
+	s := &Schema{
+		m: make(map[string]*LabelSchema, len(labels)),
+	}
+
+	for _, l := range labels {
+		switch {
+		case l.Name == "":
+			return nil, &LabelError{l.Name, "empty"}
+		case strings.HasPrefix(l.Name, ReservedLabelPrefix):
+			return nil, &LabelError{l.Name, fmt.Sprintf("prefix %q is reserved", ReservedLabelPrefix)}
+		case l.Kind < LabelExact || l.Kind > LabelSuffix:
+			return nil, errors.Errorf("invalid kind %d of label %q", l.Kind, l.Name)
+		case l.Normalization < NormalizeDefault || l.Normalization > NormalizeLowerCase:
+			return nil, errors.Errorf("invalid normalization %d of label %q", l.Normalization, l.Name)
+		case l.InBuilder != nil && l.Kind != LabelExact:
+			return nil, errors.Errorf("InBuilder of %s label %q", l.Kind, l.Name)
+		}
+		if _, ok := s.m[l.Name]; ok {
+			return nil, &LabelError{l.Name, "duplicated in schema"}
+		}
+
+		copied := *l
+		s.labels = append(s.labels, &copied)
+		s.m[l.Name] = &copied
+	}
+
+	return s, nil
+}
+
+// MustNewSchema is like NewSchema but panics with error.
+func MustNewSchema(labels ...*LabelSchema) *Schema {
+	s, err := NewSchema(labels...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Label returns the declaration of label.
+func (s *Schema) Label(name string) (*LabelSchema, bool) {
+	l, ok := s.m[name]
+	if !ok {
+		return nil, false
+	}
+	copied := *l
+	return &copied, true
+}
+
+// Labels returns all the declarations in order.
+func (s *Schema) Labels() []*LabelSchema {
+	labels := make([]*LabelSchema, 0, len(s.labels))
+	for _, l := range s.labels {
+		copied := *l
+		labels = append(labels, &copied)
+	}
+	return labels
+}
+
+// compositeLabels returns composite labels in order.
+func (s *Schema) compositeLabels() []string {
+	var labels []string
+	for _, l := range s.labels {
+		if l.Composite {
+			labels = append(labels, l.Name)
+		}
+	}
+	return labels
+}
+
+// withSchemaComposites returns conf with CompositeIdxLabels declared in Schema if it's empty,
+// so that configurations not passed through ValidateConfig build the same composite indexes.
+func (conf *Config) withSchemaComposites() *Config {
+	if conf.Schema == nil || len(conf.CompositeIdxLabels) > 0 {
+		return conf
+	}
+	labels := conf.Schema.compositeLabels()
+	if len(labels) == 0 {
+		return conf
+	}
+	copied := *conf
+	copied.CompositeIdxLabels = labels
+	return &copied
+}
+
+// checkLabel checks whether label is valid and an operation of kind is allowed for label.
+func (conf *Config) checkLabel(label string, kind LabelKind) error {
+	if err := conf.validateLabel(label); err != nil {
+		return err
+	}
+
+	if conf.Schema == nil {
+		return nil
+	}
+
+	l, ok := conf.Schema.m[label]
+	if !ok {
+		return &LabelError{label, "not declared in schema"}
+	}
+	if l.Kind != kind {
+		return &LabelError{label, fmt.Sprintf("%s operation on %s label", kind, l.Kind)}
+	}
+	return nil
+}
+
+// validateSchema validates Schema and returns CompositeIdxLabels declared in it.
+func (conf *Config) validateSchema() ([]string, error) {
+	if conf.Schema == nil {
+		return conf.CompositeIdxLabels, nil
+	}
+
+	composites := conf.Schema.compositeLabels()
+	if len(conf.CompositeIdxLabels) == 0 {
+		return composites, nil
+	}
+
+	for _, label := range conf.CompositeIdxLabels {
+		l, ok := conf.Schema.m[label]
+		if !ok {
+			return nil, &LabelError{label, "CompositeIdxLabels label not declared in schema"}
+		}
+		if !l.Composite {
+			return nil, &LabelError{label, "CompositeIdxLabels label not composite in schema"}
+		}
+	}
+	if len(composites) != len(conf.CompositeIdxLabels) {
+		return nil, &ConfigError{"CompositeIdxLabels", "don't match composite labels in schema"}
+	}
+
+	return conf.CompositeIdxLabels, nil
+}
@@ -0,0 +1,121 @@
+package xian
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// SchemaVersion is the version of the serialized form of Schema.
+const SchemaVersion = 1
+
+var (
+	labelKindNames = map[LabelKind]string{
+		LabelExact:   "exact",
+		LabelPartial: "partial",
+		LabelPrefix:  "prefix",
+		LabelSuffix:  "suffix",
+	}
+	normalizationNames = map[Normalization]string{
+		NormalizeDefault:   "default",
+		NormalizeNone:      "none",
+		NormalizeLowerCase: "lowercase",
+	}
+)
+
+// MarshalText encodes k as its name.
+func (k LabelKind) MarshalText() ([]byte, error) {
+	name, ok := labelKindNames[k]
+	if !ok {
+		return nil, errors.Errorf("invalid kind %d", k)
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes the name of a kind.
+func (k *LabelKind) UnmarshalText(text []byte) error {
+	for kind, name := range labelKindNames {
+		if name == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return errors.Errorf("unknown kind %q", text)
+}
+
+// MarshalText encodes n as its name.
+func (n Normalization) MarshalText() ([]byte, error) {
+	name, ok := normalizationNames[n]
+	if !ok {
+		return nil, errors.Errorf("invalid normalization %d", n)
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes the name of a normalization.
+func (n *Normalization) UnmarshalText(text []byte) error {
+	for normalization, name := range normalizationNames {
+		if name == string(text) {
+			*n = normalization
+			return nil
+		}
+	}
+	return errors.Errorf("unknown normalization %q", text)
+}
+
+// schemaDocument is a serialized form of Schema.
+type schemaDocument struct {
+	Version int            `json:"version" yaml:"version"`
+	Labels  []*LabelSchema `json:"labels" yaml:"labels"`
+}
+
+func (s *Schema) document() *schemaDocument {
+	return &schemaDocument{
+		Version: SchemaVersion,
+		Labels:  s.Labels(),
+	}
+}
+
+func (s *Schema) restore(doc *schemaDocument) error {
+	if doc.Version != SchemaVersion {
+		return errors.Errorf("unsupported schema version %d", doc.Version)
+	}
+	restored, err := NewSchema(doc.Labels...)
+	if err != nil {
+		return err
+	}
+	*s = *restored
+	return nil
+}
+
+// MarshalJSON encodes labels of s.
+// Save Config including Schema to keep settings which change tokens such as IgnoreCase.
+//
+//	{"version":1,"labels":[{"name":"ti","kind":"partial","normalization":"lowercase"},{"name":"s","kind":"exact","in":{...}}]}
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.document())
+}
+
+// UnmarshalJSON restores labels encoded by MarshalJSON.
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	var doc schemaDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	return s.restore(&doc)
+}
+
+// MarshalYAML returns the same form as MarshalJSON for YAML encoders such as gopkg.in/yaml.
+// InBuilder is encoded with its MarshalText.
+func (s *Schema) MarshalYAML() (interface{}, error) {
+	return s.document(), nil
+}
+
+// UnmarshalYAML restores labels encoded by MarshalYAML.
+func (s *Schema) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var doc schemaDocument
+	if err := unmarshal(&doc); err != nil {
+		return err
+	}
+	return s.restore(&doc)
+}
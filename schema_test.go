@@ -0,0 +1,280 @@
+package xian
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func newTestSchema() *Schema {
+	return MustNewSchema(
+		&LabelSchema{Name: "ti", Kind: LabelPartial, Normalization: NormalizeLowerCase},
+		&LabelSchema{Name: "tp", Kind: LabelPrefix},
+		&LabelSchema{Name: "ts", Kind: LabelSuffix},
+		&LabelSchema{Name: "s", Kind: LabelExact, Composite: true},
+		&LabelSchema{Name: "c", Kind: LabelExact, Composite: true, Normalization: NormalizeNone},
+	)
+}
+
+func TestNewSchema(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		label *LabelSchema
+	}{
+		{"空のラベル", &LabelSchema{Kind: LabelExact}},
+		{"予約されたラベル", &LabelSchema{Name: "__a", Kind: LabelExact}},
+		{"不正なKind", &LabelSchema{Name: "a"}},
+		{"不正なNormalization", &LabelSchema{Name: "a", Kind: LabelExact, Normalization: -1}},
+		{"重複したラベル", &LabelSchema{Name: "ti", Kind: LabelExact}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewSchema(append(newTestSchema().Labels(), tc.label)...); err == nil {
+				t.Error("error = nil, wants != nil")
+			}
+		})
+	}
+
+	s := newTestSchema()
+	l, ok := s.Label("tp")
+	assert(t, "ok", ok, true)
+	assert(t, "Kind", l.Kind, LabelPrefix)
+	_, ok = s.Label("xx")
+	assert(t, "undeclared", ok, false)
+}
+
+func TestSchemaOperations(t *testing.T) {
+	conf := MustValidateConfig(&Config{Schema: newTestSchema(), IgnoreCase: true})
+
+	t.Run("宣言通りの操作", func(t *testing.T) {
+		idxs := NewIndexes(conf).
+			AddBiunigrams("ti", "AB").
+			AddPrefixes("tp", "AB").
+			AddSuffixes("ts", "AB").
+			Add("s", "X").
+			AddSomething("c", "X")
+
+		assertBuiltIndex(t, idxs.MustBuild(), []string{
+			"ti a", "ti b", "ti ab",
+			"tp a", "tp ab",
+			"ts b", "ts ba",
+			"s x",
+			"c X",
+			"3 x;X",
+		})
+
+		filters := NewFilters(conf).AddBigrams("ti", "Ab").AddPrefix("tp", "A").AddSuffix("ts", "B").Add("s", "X")
+		assertBuiltFilter(t, filters.MustBuild(), []string{"ti ab", "tp a", "ts b", "s x"})
+	})
+
+	t.Run("ValidateConfigを通さない場合", func(t *testing.T) {
+		conf := &Config{Schema: newTestSchema(), IgnoreCase: true}
+
+		built := NewIndexes(conf).Add("s", "X").AddSomething("c", "X").MustBuild()
+		assertBuiltIndex(t, built, []string{"s x", "c X", "3 x;X"})
+
+		filters := NewFilters(conf).Add("s", "X").AddSomething("c", "X")
+		assertBuiltFilter(t, filters.MustBuild(), []string{"3 x;X"})
+
+		entry, err := ParseIndex(conf, "3 x;X")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assert(t, "Kind", entry.Kind, EntryComposite)
+	})
+
+	for _, tc := range []struct {
+		name    string
+		indexes *Indexes
+		filters *Filters
+	}{
+		{
+			"種類が異なる操作",
+			NewIndexes(conf).AddBiunigrams("tp", "abc"),
+			NewFilters(conf).AddBiunigrams("tp", "abc"),
+		},
+		{
+			"完全一致ラベルへの部分一致",
+			NewIndexes(conf).AddBigrams("s", "abc"),
+			NewFilters(conf).AddSuffix("s", "abc"),
+		},
+		{
+			"部分一致ラベルへの完全一致",
+			NewIndexes(conf).AddSomething("ti", "abc"),
+			NewFilters(conf).Add("ti", "abc"),
+		},
+		{
+			"宣言されていないラベル",
+			NewIndexes(conf).Add("xx", "abc"),
+			NewFilters(conf).AddSomething("xx", 1),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.indexes.Err() == nil {
+				t.Error("indexes error = nil, wants != nil")
+			}
+			if _, err := tc.indexes.Add("s", "1").Build(); err == nil {
+				t.Error("indexes build error = nil, wants != nil")
+			}
+			if tc.filters.Err() == nil {
+				t.Error("filters error = nil, wants != nil")
+			}
+			if _, err := tc.filters.Clone().Add("s", "1").Build(); err == nil {
+				t.Error("filters build error = nil, wants != nil")
+			}
+		})
+	}
+}
+
+func TestValidateConfigSchema(t *testing.T) {
+	t.Run("CompositeIdxLabelsを補完", func(t *testing.T) {
+		orig := &Config{Schema: newTestSchema()}
+		conf := MustValidateConfig(orig)
+		assert(t, "len(CompositeIdxLabels)", len(conf.CompositeIdxLabels), 2)
+		assert(t, "CompositeIdxLabels[0]", conf.CompositeIdxLabels[0], "s")
+		assert(t, "original", len(orig.CompositeIdxLabels), 0)
+	})
+
+	t.Run("CompositeIdxLabelsが一致する場合", func(t *testing.T) {
+		_, err := ValidateConfig(&Config{Schema: newTestSchema(), CompositeIdxLabels: []string{"c", "s"}})
+		if err != nil {
+			t.Errorf("error = %s, wants = nil", err)
+		}
+	})
+
+	for _, tc := range []struct {
+		name   string
+		labels []string
+	}{
+		{"宣言されていないラベル", []string{"s", "c", "xx"}},
+		{"compositeでないラベル", []string{"s", "c", "ti"}},
+		{"compositeのラベルが不足", []string{"s"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ValidateConfig(&Config{Schema: newTestSchema(), CompositeIdxLabels: tc.labels}); err == nil {
+				t.Error("error = nil, wants != nil")
+			}
+		})
+	}
+}
+
+func TestSchemaMarshalJSON(t *testing.T) {
+	in := NewInBuilderWithConfig(&InConfig{GroupSize: CompactInGroupSize})
+	in.MustNewBitNamed("published", 1)
+
+	schema := MustNewSchema(
+		&LabelSchema{Name: "ti", Kind: LabelPartial, Normalization: NormalizeLowerCase},
+		&LabelSchema{Name: "s", Kind: LabelExact, Composite: true, InBuilder: in},
+	)
+
+	b, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"version":1,"labels":[{"name":"ti","kind":"partial","normalization":"lowercase"},` +
+		`{"name":"s","kind":"exact","composite":true,"in":{"groupSize":4,"bits":{"published":1}}}]}`
+	assert(t, "json", string(b), expected)
+
+	restored := &Schema{}
+	if err := json.Unmarshal(b, restored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, schema) {
+		t.Errorf("unexpected, actual: `%#v`, expected: `%#v`", restored, schema)
+	}
+
+	for _, s := range []string{
+		`{"version":2,"labels":[]}`,
+		`{"version":1,"labels":[{"name":"ti","kind":"trigram"}]}`,
+		`{"version":1,"labels":[{"name":"ti","kind":"exact","normalization":"upper"}]}`,
+		`{"version":1,"labels":[{"name":"ti","kind":"exact"},{"name":"ti","kind":"partial"}]}`,
+		`{"version":1,"labels":[{"name":"ti","kind":"partial","in":{"groupSize":4,"bits":{}}}]}`,
+	} {
+		t.Run(s, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(s), &Schema{}); err == nil {
+				t.Error("error = nil, wants != nil")
+			}
+		})
+	}
+}
+
+func TestConfigMarshalYAML(t *testing.T) {
+	doc := `
+ignoreCase: true
+escapeSeparators: true
+compositeIdxCombinations:
+- [s, c]
+schema:
+  version: 1
+  labels:
+  - name: ti
+    kind: partial
+  - name: s
+    kind: exact
+    composite: true
+    in: |
+      group-size 4
+      1 "published"
+  - name: c
+    kind: exact
+    normalization: none
+    composite: true
+  - name: pr
+    kind: exact
+    composite: true
+`
+
+	var conf Config
+	if err := yaml.Unmarshal([]byte(doc), &conf); err != nil {
+		t.Fatal(err)
+	}
+	conf = *MustValidateConfig(&conf)
+
+	l, ok := conf.Schema.Label("s")
+	assert(t, "ok", ok, true)
+	published, ok := l.InBuilder.Bit("published")
+	assert(t, "published", ok, true)
+
+	built := NewIndexes(&conf).
+		AddBiunigrams("ti", "AB").
+		Add("s", l.InBuilder.Indexes(published)...).
+		Add("c", "Sports Cars").
+		Add("pr", "p<3000").
+		MustBuild()
+	assertBuiltIndex(t, built, []string{
+		"ti a", "ti b", "ti ab",
+		"s 2", "s 3",
+		"c Sports%20Cars",
+		"pr p<3000",
+		"3 2;Sports%20Cars", "3 3;Sports%20Cars",
+	})
+
+	b, err := yaml.Marshal(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored Config
+	if err := yaml.Unmarshal(b, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&restored, &conf) {
+		t.Errorf("unexpected, actual: `%#v`, expected: `%#v`", &restored, &conf)
+	}
+	assert(t, "Fingerprint", restored.Fingerprint(), conf.Fingerprint())
+
+	t.Run("JSON", func(t *testing.T) {
+		b, err := json.Marshal(&conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var restored Config
+		if err := json.Unmarshal(b, &restored); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&restored, &conf) {
+			t.Errorf("unexpected, actual: `%#v`, expected: `%#v`", &restored, &conf)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package xian
+
+import (
+	"sort"
+)
+
+// Stats collects document frequencies of tokens from built indexes.
+// Stats can be serialized with encoding/json and encoding/gob.
+// Stats is not safe for concurrent use.
+type Stats struct {
+	// Docs is the number of added index slices.
+	Docs int `json:"docs"`
+	// Frequencies is the number of index slices containing each token.
+	// key=label, value=(key=token, value=frequency)
+	Frequencies map[string]map[string]int `json:"frequencies"`
+
+	conf *Config
+}
+
+// NewStats creates and initializes a new Stats.
+// conf should be the same as the one used to build indexes.
+func NewStats(conf *Config) *Stats {
+	if conf == nil {
+		conf = DefaultConfig
+	}
+	return &Stats{
+		Frequencies: make(map[string]map[string]int),
+		conf:        conf,
+	}
+}
+
+// Add adds indexes built by Indexes.Build.
+// Composite indexes and IndexNoFilters are ignored.
+func (s *Stats) Add(indexes []string) *Stats {
+	conf := s.conf
+	if conf == nil {
+		conf = DefaultConfig
+	}
+	if s.Frequencies == nil {
+		s.Frequencies = make(map[string]map[string]int)
+	}
+
+	s.Docs++
+
+	for _, idx := range indexes {
+		label, token, ok := conf.splitIndex(idx)
+		if !ok {
+			continue
+		}
+		if _, ok := s.Frequencies[label]; !ok {
+			s.Frequencies[label] = make(map[string]int)
+		}
+		s.Frequencies[label][token]++
+	}
+
+	return s
+}
+
+// Merge adds all the frequencies of other to s.
+func (s *Stats) Merge(other *Stats) *Stats {
+	if s.Frequencies == nil {
+		s.Frequencies = make(map[string]map[string]int)
+	}
+
+	s.Docs += other.Docs
+
+	for label, freqs := range other.Frequencies {
+		if _, ok := s.Frequencies[label]; !ok {
+			s.Frequencies[label] = make(map[string]int)
+		}
+		for token, n := range freqs {
+			s.Frequencies[label][token] += n
+		}
+	}
+
+	return s
+}
+
+// Frequency returns the number of index slices containing the token of the label.
+// token is normalized as well as Indexes.Add.
+func (s *Stats) Frequency(label, token string) int {
+	conf := s.conf
+	if conf == nil {
+		conf = DefaultConfig
+	}
+	return s.Frequencies[label][conf.normalize(label, token)]
+}
+
+// SelectTokens selects max tokens with the lowest frequencies, which are the most selective.
+// Stats can be used with Filters.LimitPartialFilters.
+func (s *Stats) SelectTokens(label string, tokens []string, max int) []string {
+	if len(tokens) <= max {
+		return tokens
+	}
+
+	sorted := make([]string, len(tokens))
+	copy(sorted, tokens)
+
+	freqs := s.Frequencies[label]
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return freqs[sorted[i]] < freqs[sorted[j]]
+	})
+
+	return sorted[:max]
+}
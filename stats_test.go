@@ -0,0 +1,79 @@
+package xian
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	conf := &Config{
+		CompositeIdxLabels: []string{"ti", "s"},
+		IgnoreCase:         true,
+		SaveNoFiltersIndex: true,
+	}
+
+	stats := NewStats(conf)
+	stats.Add(NewIndexes(conf).AddBigrams("ti", "abc").Add("s", "1").MustBuild())
+	stats.Add(NewIndexes(conf).AddBigrams("ti", "abd").Add("s", "1").MustBuild())
+
+	assert(t, "Docs", stats.Docs, 2)
+
+	expected := map[string]map[string]int{
+		"ti": {"ab": 2, "bc": 1, "bd": 1},
+		"s":  {"1": 2},
+	}
+	if !reflect.DeepEqual(stats.Frequencies, expected) {
+		t.Errorf("unexpected, actual: `%v`, expected: `%v`", stats.Frequencies, expected)
+	}
+
+	assert(t, "Frequency(ti, AB)", stats.Frequency("ti", "AB"), 2)
+	assert(t, "Frequency(ti, xx)", stats.Frequency("ti", "xx"), 0)
+
+	t.Run("Merge", func(t *testing.T) {
+		other := NewStats(conf).Add(NewIndexes(conf).AddBigrams("ti", "bcd").MustBuild())
+		merged := NewStats(conf).Merge(stats).Merge(other)
+
+		assert(t, "Docs", merged.Docs, 3)
+		assert(t, "Frequency(ti, bc)", merged.Frequency("ti", "bc"), 2)
+		assert(t, "Frequency(ti, cd)", merged.Frequency("ti", "cd"), 1)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		b, err := json.Marshal(stats)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := NewStats(conf)
+		if err := json.Unmarshal(b, restored); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(restored, stats) {
+			t.Errorf("unexpected, actual: `%v`, expected: `%v`", restored, stats)
+		}
+	})
+
+	t.Run("gob", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(stats); err != nil {
+			t.Fatal(err)
+		}
+		restored := NewStats(conf)
+		if err := gob.NewDecoder(&buf).Decode(restored); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(restored, stats) {
+			t.Errorf("unexpected, actual: `%v`, expected: `%v`", restored, stats)
+		}
+	})
+
+	t.Run("LimitPartialFilters", func(t *testing.T) {
+		filters := NewFilters(nil).AddBiunigrams("ti", "abcd").LimitPartialFilters(1, stats)
+		assertBuiltFilter(t, filters.MustBuild(), []string{"ti cd"})
+
+		filters = NewFilters(nil).AddBiunigrams("ti", "abc").LimitPartialFilters(1, stats)
+		assertBuiltFilter(t, filters.MustBuild(), []string{"ti bc"})
+	})
+}
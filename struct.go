@@ -0,0 +1,165 @@
+package xian
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/knightso/xian/internal/structtag"
+	"github.com/pkg/errors"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// AddStruct adds indexes of fields of v tagged with `xian:"label,options..."`.
+// v must be a struct or a pointer to a struct.
+//
+// Options are bigrams, biunigrams, prefixes and suffixes for string fields.
+// A field without options is added with AddSomething.
+// Multiple labels can be separated with ';' like `xian:"ti,bigrams,biunigrams;tp,prefixes"`.
+// Elements of slices are added one by one, nil pointers are skipped
+// and untagged struct fields except time.Time are added recursively.
+// Fields tagged with "-" are ignored.
+// The in option for code generated by cmd/xiangen is not supported.
+func (idxs *Indexes) AddStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return errors.New("nil pointer")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return errors.Errorf("%T is not a struct", v)
+	}
+
+	return idxs.addStruct(rv)
+}
+
+// MustAddStruct is like AddStruct but panics with error.
+func (idxs *Indexes) MustAddStruct(v interface{}) *Indexes {
+	if err := idxs.AddStruct(v); err != nil {
+		panic(err)
+	}
+	return idxs
+}
+
+func (idxs *Indexes) addStruct(rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag, tagged := sf.Tag.Lookup(structtag.Name)
+		if tag == "-" {
+			continue
+		}
+
+		if sf.PkgPath != "" && (tagged || !sf.Anonymous) {
+			// unexported fields except embedded structs
+			continue
+		}
+
+		fv := rv.Field(i)
+
+		if !tagged {
+			if err := idxs.addNested(fv); err != nil {
+				return errors.Wrapf(err, "%s", sf.Name)
+			}
+			continue
+		}
+
+		tags, err := structtag.Parse(tag)
+		if err != nil {
+			return errors.Wrapf(err, "%s", sf.Name)
+		}
+		for _, st := range tags {
+			if err := idxs.addField(st, fv); err != nil {
+				return errors.Wrapf(err, "%s", sf.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// addNested adds untagged struct fields recursively.
+func (idxs *Indexes) addNested(fv reflect.Value) error {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+
+	switch {
+	case fv.Type() == timeType:
+		return nil
+	case fv.Kind() == reflect.Struct:
+		return idxs.addStruct(fv)
+	case fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			if err := idxs.addNested(fv.Index(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addField adds indexes of a tagged field.
+func (idxs *Indexes) addField(st structtag.Tag, fv reflect.Value) error {
+	if st.In != "" {
+		return errors.Errorf("in option of %q is supported only by xiangen", st.Label)
+	}
+
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+
+	switch {
+	case fv.Type() == timeType:
+		if len(st.Options) > 0 {
+			return errors.Errorf("options %v for %s", st.Options, fv.Type())
+		}
+		idxs.AddSomething(st.Label, fv.Interface())
+		return nil
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8:
+		return errors.Errorf("unsupported type %s", fv.Type())
+	case fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			if err := idxs.addField(st, fv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case fv.Kind() == reflect.Struct || fv.Kind() == reflect.Map || fv.Kind() == reflect.Func || fv.Kind() == reflect.Chan:
+		return errors.Errorf("unsupported type %s", fv.Type())
+	}
+
+	if len(st.Options) == 0 {
+		idxs.AddSomething(st.Label, fv.Interface())
+		return nil
+	}
+
+	if fv.Kind() != reflect.String {
+		return errors.Errorf("options %v for %s", st.Options, fv.Type())
+	}
+
+	s := fv.String()
+	for _, o := range st.Options {
+		switch o {
+		case structtag.Bigrams:
+			idxs.AddBigrams(st.Label, s)
+		case structtag.Biunigrams:
+			idxs.AddBiunigrams(st.Label, s)
+		case structtag.Prefixes:
+			idxs.AddPrefixes(st.Label, s)
+		case structtag.Suffixes:
+			idxs.AddSuffixes(st.Label, s)
+		default:
+			panic(fmt.Sprintf("unexpected option %q", o))
+		}
+	}
+	return nil
+}
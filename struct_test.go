@@ -0,0 +1,101 @@
+package xian
+
+import (
+	"testing"
+	"time"
+)
+
+type testAuthor struct {
+	Name string `xian:"au"`
+}
+
+type testBookBase struct {
+	Category string `xian:"c"`
+}
+
+type testBook struct {
+	testBookBase
+	Title     string    `xian:"ti,bigrams,biunigrams;tp,prefixes;ts,suffixes"`
+	Tags      []string  `xian:"tg"`
+	Price     *int      `xian:"pr"`
+	Note      *string   `xian:"n,bigrams"`
+	Published time.Time `xian:"pa"`
+	IsHobby   bool      `xian:"h"`
+	Authors   []testAuthor
+	Editor    *testAuthor
+	Secret    string `xian:"-"`
+	Ignored   string
+	internal  string `xian:"in"`
+}
+
+func TestAddStruct(t *testing.T) {
+	price := 1000
+	published := time.Date(2020, 7, 14, 0, 0, 0, 0, time.UTC)
+	book := &testBook{
+		testBookBase: testBookBase{Category: "sports"},
+		Title:        "abc",
+		Tags:         []string{"go", "rust"},
+		Price:        &price,
+		Published:    published,
+		IsHobby:      true,
+		Authors:      []testAuthor{{Name: "rowling"}, {Name: "tolkien"}},
+		Secret:       "secret",
+		Ignored:      "ignored",
+		internal:     "internal",
+	}
+
+	idxs := NewIndexes(nil)
+	if err := idxs.AddStruct(book); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := NewIndexes(nil).
+		Add("c", "sports").
+		AddBigrams("ti", "abc").
+		AddBiunigrams("ti", "abc").
+		AddPrefixes("tp", "abc").
+		AddSuffixes("ts", "abc").
+		Add("tg", "go", "rust").
+		AddSomething("pr", 1000).
+		AddSomething("pa", published).
+		AddSomething("h", true).
+		Add("au", "rowling", "tolkien")
+
+	assertBuiltIndex(t, idxs.MustBuild(), expected.MustBuild())
+
+	t.Run("Configを使う", func(t *testing.T) {
+		idxs := NewIndexes(&Config{IgnoreCase: true}).MustAddStruct(&testAuthor{Name: "Rowling"})
+		assertBuiltIndex(t, idxs.MustBuild(), []string{"au rowling"})
+	})
+}
+
+func TestAddStructError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"構造体ではない", "abc"},
+		{"nilポインタ", (*testBook)(nil)},
+		{"空のラベル", &struct {
+			A string `xian:",bigrams"`
+		}{}},
+		{"不明なオプション", &struct {
+			A string `xian:"a,trigrams"`
+		}{}},
+		{"文字列以外のオプション", &struct {
+			A int `xian:"a,prefixes"`
+		}{}},
+		{"inオプション", &struct {
+			A Bit `xian:"a,in=statusInBuilder"`
+		}{}},
+		{"タグ付きの構造体", &struct {
+			A testAuthor `xian:"a"`
+		}{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := NewIndexes(nil).AddStruct(tc.v); err == nil {
+				t.Error("error = nil, wants != nil")
+			}
+		})
+	}
+}
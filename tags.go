@@ -0,0 +1,63 @@
+package xian
+
+import (
+	"hash/fnv"
+)
+
+// TagBuckets creates IN indexes for free-form tags without predeclared bits.
+//
+// Tags are hashed into buckets and each bucket is mapped to a bit of InBuilder,
+// so that a query for any of tags needs a filter for each group of buckets.
+// Different tags in the same bucket match each other,
+// so that results must be verified with the original tags.
+type TagBuckets struct {
+	in   *InBuilder
+	bits []Bit
+}
+
+// NewTagBuckets creates TagBuckets with the number of buckets.
+// conf configures InBuilder for the buckets.
+// More buckets reduce false positives while creating more indexes.
+func NewTagBuckets(buckets int, conf *InConfig) *TagBuckets {
+	if buckets < 1 {
+		panic("buckets must be positive")
+	}
+
+	tb := &TagBuckets{
+		in:   NewInBuilderWithConfig(conf),
+		bits: make([]Bit, buckets),
+	}
+	for i := range tb.bits {
+		tb.bits[i] = tb.in.NewBit()
+	}
+
+	return tb
+}
+
+func (tb *TagBuckets) bit(tag string) Bit {
+	h := fnv.New32a()
+	h.Write([]byte(tag))
+	return tb.bits[h.Sum32()%uint32(len(tb.bits))]
+}
+
+func (tb *TagBuckets) bitsOf(tags []string) []Bit {
+	bits := make([]Bit, 0, len(tags))
+	for _, tag := range tags {
+		bits = append(bits, tb.bit(tag))
+	}
+	return bits
+}
+
+// Indexes creates indexes for tags of an entity.
+func (tb *TagBuckets) Indexes(tags ...string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	return tb.in.Indexes(tb.bitsOf(tags)...)
+}
+
+// FilterSets creates alternative filters to search entities with any of tags.
+// Each filter needs its own query and the results should be merged.
+func (tb *TagBuckets) FilterSets(tags ...string) []string {
+	return tb.in.FilterSets(tb.bitsOf(tags)...)
+}
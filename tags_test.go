@@ -0,0 +1,45 @@
+package xian
+
+import (
+	"testing"
+)
+
+func TestTagBuckets(t *testing.T) {
+	tb := NewTagBuckets(8, &InConfig{GroupSize: CompactInGroupSize})
+
+	// find tags in different buckets.
+	tags := []string{"go"}
+	for _, tag := range []string{"rust", "java", "ruby", "php", "perl", "lua", "c", "d"} {
+		if tb.bit(tag) != tb.bit(tags[0]) {
+			tags = append(tags, tag)
+		}
+		if len(tags) == 3 {
+			break
+		}
+	}
+	if len(tags) != 3 {
+		t.Fatal("tags in different buckets not found")
+	}
+
+	idxs := NewIndexes(nil).Add("tg", tb.Indexes(tags[0])...).MustBuild()
+
+	matches := func(tags ...string) bool {
+		for _, f := range tb.FilterSets(tags...) {
+			if containsString(idxs, "tg "+f) {
+				return true
+			}
+		}
+		return false
+	}
+
+	assert(t, "the tag", matches(tags[0]), true)
+	assert(t, "any of tags", matches(tags[1], tags[0], tags[2]), true)
+	assert(t, "other tags", matches(tags[1], tags[2]), false)
+
+	if len(tb.Indexes(tags...)) > 30 {
+		t.Errorf("len(indexes) expected:<=30, but was:%d", len(tb.Indexes(tags...)))
+	}
+	if len(tb.Indexes()) != 0 {
+		t.Errorf("unexpected indexes for no tags: %v", tb.Indexes())
+	}
+}
@@ -67,6 +67,7 @@ func Prefixes(s string) []string {
 }
 
 // Suffixes returns suffix tokens from s.
+// Tokens are reversed words, e.g. "r", "re" and "ret" for "ter".
 func Suffixes(s string) []string {
 	suffixes := make(map[string]struct{})
 
@@ -95,6 +96,11 @@ func Suffixes(s string) []string {
 	return tokens
 }
 
+// ReverseSuffix reverses s for Filters.AddSuffix, since suffix tokens are reversed words.
+func ReverseSuffix(s string) string {
+	return reverse(s)
+}
+
 func reverse(s string) string {
 	runes := []rune(s)
 	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
@@ -115,6 +121,24 @@ func toBigrams(value string) map[bigram]bool {
 	return result
 }
 
+// orderedBigrams returns unique bigram tokens from s in order of appearance.
+func orderedBigrams(value string) []string {
+	var tokens []string
+	seen := make(map[bigram]bool)
+	var prev rune
+	for i, r := range value {
+		if i > 0 && prev != ' ' && r != ' ' {
+			b := bigram{prev, r}
+			if !seen[b] {
+				seen[b] = true
+				tokens = append(tokens, b.String())
+			}
+		}
+		prev = r
+	}
+	return tokens
+}
+
 func toUnigrams(value string) map[rune]bool {
 	result := make(map[rune]bool)
 	for _, r := range value {
@@ -1,13 +1,11 @@
 package xian
 
 import (
-	"bytes"
 	"fmt"
 	"reflect"
 	"sort"
+	"strings"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 const (
@@ -17,6 +15,8 @@ const (
 	MaxIndexesSize = 512
 	// MaxCompositeIndexLabels maximum number of labels for composite index.
 	MaxCompositeIndexLabels = 8
+	// MaxSizedCompositeIndexLabels maximum number of labels for composite index with CompositeIdxMaxSize.
+	MaxSizedCompositeIndexLabels = 64
 )
 
 const (
@@ -24,13 +24,38 @@ const (
 )
 
 // Config describe extra indexes configuration.
+// It can be saved with encoding/json or YAML encoders including Schema
+// for clients in other languages to build the same tokens.
 type Config struct {
 	// CompositeIdxLabels is a label list which defines composit indexes to improve the search performance
-	CompositeIdxLabels []string
+	CompositeIdxLabels []string `json:"compositeIdxLabels,omitempty" yaml:"compositeIdxLabels,omitempty"`
+	// CompositeIdxMaxSize is maximum number of labels combined in a composite index.
+	// Composite indexes of all the combinations of CompositeIdxLabels are saved if it's zero,
+	// which is limited to MaxCompositeIndexLabels labels.
+	// Otherwise CompositeIdxLabels is limited to MaxSizedCompositeIndexLabels labels.
+	CompositeIdxMaxSize int `json:"compositeIdxMaxSize,omitempty" yaml:"compositeIdxMaxSize,omitempty"`
+	// CompositeIdxCombinations is an explicit list of label combinations to save composite indexes
+	// instead of all the combinations. Each label must be in CompositeIdxLabels and combinations must be distinct,
+	// whose positions define IDs of the combinations.
+	// Filters uses the combinations which cover the most labels and single label filters for the rest.
+	CompositeIdxCombinations [][]string `json:"compositeIdxCombinations,omitempty" yaml:"compositeIdxCombinations,omitempty"`
 	// IgnoreCase defines whether to ignore case on search
-	IgnoreCase bool
+	IgnoreCase bool `json:"ignoreCase" yaml:"ignoreCase"`
 	// SaveNoFiltersIndex defines whether to save IndexNoFilters index.
-	SaveNoFiltersIndex bool
+	SaveNoFiltersIndex bool `json:"saveNoFiltersIndex,omitempty" yaml:"saveNoFiltersIndex,omitempty"`
+	// EscapeSeparators defines whether to percent-encode '%', ' ' and ';' in labels and tokens
+	// and the first digit of labels consisting of digits, which can't be distinguished from composite indexes.
+	// Indexes saved without it can contain ambiguous or colliding indexes and must be rebuilt to enable it.
+	EscapeSeparators bool `json:"escapeSeparators,omitempty" yaml:"escapeSeparators,omitempty"`
+	// SaveFingerprintIndex defines whether to save FingerprintIndex
+	// to detect entities saved with another configuration.
+	SaveFingerprintIndex bool `json:"saveFingerprintIndex,omitempty" yaml:"saveFingerprintIndex,omitempty"`
+	// BudgetPolicy defines how to degrade indexes exceeding MaxIndexesSize.
+	// Indexes.Build fails with such indexes if it's nil.
+	BudgetPolicy *BudgetPolicy `json:"budgetPolicy,omitempty" yaml:"budgetPolicy,omitempty"`
+	// Schema declares labels. Labels are not checked if it's nil.
+	// ValidateConfig sets CompositeIdxLabels to composite labels of Schema if it's empty.
+	Schema *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
 }
 
 // DefaultConfig is default configuration.
@@ -40,8 +65,22 @@ var timeKind = reflect.TypeOf(time.Time{}).Kind()
 
 // ValidateConfig validates Config fields.
 func ValidateConfig(conf *Config) (*Config, error) {
-	if len(conf.CompositeIdxLabels) > MaxCompositeIndexLabels {
-		return nil, errors.Errorf("CompositeIdxLabels size exceeds %d", MaxCompositeIndexLabels)
+	composites, err := conf.validateSchema()
+	if err != nil {
+		return nil, err
+	}
+	if len(composites) != len(conf.CompositeIdxLabels) {
+		copied := *conf
+		copied.CompositeIdxLabels = composites
+		conf = &copied
+	}
+
+	if err := conf.validateLabels(); err != nil {
+		return nil, err
+	}
+
+	if err := conf.validateCompositeIdxLabels(); err != nil {
+		return nil, err
 	}
 	return conf, nil
 }
@@ -55,13 +94,58 @@ func MustValidateConfig(conf *Config) *Config {
 	return conf
 }
 
+// normalize normalizes s of label according to the configuration.
+// It's applied to both indexes and filters.
+func (conf *Config) normalize(label, s string) string {
+	normalization := NormalizeDefault
+	if conf.Schema != nil {
+		if l, ok := conf.Schema.m[label]; ok {
+			normalization = l.Normalization
+		}
+	}
+
+	switch normalization {
+	case NormalizeLowerCase:
+		return strings.ToLower(s)
+	case NormalizeNone:
+		return s
+	}
+
+	if conf.IgnoreCase {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// splitIndex splits a built index into a label and a token.
+// ok is false for indexes without labels such as IndexNoFilters and composite indexes.
+func (conf *Config) splitIndex(idx string) (label, token string, ok bool) {
+	entry, err := ParseIndex(conf, idx)
+	if err != nil || entry.Kind != EntryLabel {
+		return "", "", false
+	}
+	return entry.Label, entry.Token, true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 // common indexes map
 // key=label, value=index set
 type indexesMap map[string]map[string]struct{}
 
 // buildIndexes builds indexes from m.
 // m is map[label]tokens.
-func buildIndexes(m indexesMap, labelsToExclude []string) []string {
+func buildIndexes(conf *Config, m indexesMap, labelsToExclude []string) []string {
 	idxSet := make(map[string]struct{})
 
 	excludeSet := make(map[string]struct{})
@@ -73,8 +157,9 @@ func buildIndexes(m indexesMap, labelsToExclude []string) []string {
 		if _, ok := excludeSet[label]; ok {
 			continue
 		}
+		escaped := conf.escapeLabel(label)
 		for t := range tokens {
-			idxSet[fmt.Sprintf("%s %s", label, t)] = struct{}{}
+			idxSet[fmt.Sprintf("%s %s", escaped, conf.escapeToken(t))] = struct{}{}
 		}
 	}
 
@@ -89,92 +174,279 @@ func buildIndexes(m indexesMap, labelsToExclude []string) []string {
 	return built
 }
 
+// validateCompositeIdxLabels validates CompositeIdxLabels, CompositeIdxMaxSize and CompositeIdxCombinations.
+func (conf *Config) validateCompositeIdxLabels() error {
+	if len(conf.CompositeIdxCombinations) > 0 {
+		if conf.CompositeIdxMaxSize != 0 {
+			return &ConfigError{"CompositeIdxMaxSize", "can't be used with CompositeIdxCombinations"}
+		}
+		if len(conf.CompositeIdxLabels) > MaxSizedCompositeIndexLabels {
+			return &ConfigError{"CompositeIdxLabels", fmt.Sprintf("size exceeds %d", MaxSizedCompositeIndexLabels)}
+		}
+		_, err := conf.combinationPositions()
+		return err
+	}
+
+	if conf.CompositeIdxMaxSize == 0 {
+		if len(conf.CompositeIdxLabels) > MaxCompositeIndexLabels {
+			return &ConfigError{"CompositeIdxLabels", fmt.Sprintf("size exceeds %d", MaxCompositeIndexLabels)}
+		}
+		return nil
+	}
+
+	if conf.CompositeIdxMaxSize < 2 {
+		return &ConfigError{"CompositeIdxMaxSize", "must be 2 or more"}
+	}
+	if len(conf.CompositeIdxLabels) > MaxSizedCompositeIndexLabels {
+		return &ConfigError{"CompositeIdxLabels", fmt.Sprintf("size exceeds %d", MaxSizedCompositeIndexLabels)}
+	}
+	return nil
+}
+
+// compositeMaxSize returns maximum number of labels combined in a composite index.
+func (conf *Config) compositeMaxSize() int {
+	if conf.CompositeIdxMaxSize == 0 {
+		return len(conf.CompositeIdxLabels)
+	}
+	return conf.CompositeIdxMaxSize
+}
+
+// combinationPositions returns positions of labels for each of CompositeIdxCombinations.
+func (conf *Config) combinationPositions() ([][]int, error) {
+	positions := make(map[string]int, len(conf.CompositeIdxLabels))
+	for i, label := range conf.CompositeIdxLabels {
+		positions[label] = i
+	}
+
+	combis := make([][]int, 0, len(conf.CompositeIdxCombinations))
+	seen := make(map[string][]string, len(conf.CompositeIdxCombinations)) // key=sorted positions
+	for _, labels := range conf.CompositeIdxCombinations {
+		if len(labels) < 2 {
+			return nil, &ConfigError{"CompositeIdxCombinations", fmt.Sprintf("%v must have 2 or more labels", labels)}
+		}
+
+		combi := make([]int, 0, len(labels))
+		for _, label := range labels {
+			pos, ok := positions[label]
+			if !ok {
+				return nil, &LabelError{label, "CompositeIdxCombinations label not in CompositeIdxLabels"}
+			}
+			for _, p := range combi {
+				if p == pos {
+					return nil, &LabelError{label, fmt.Sprintf("duplicated in CompositeIdxCombinations %v", labels)}
+				}
+			}
+			combi = append(combi, pos)
+		}
+		sort.Ints(combi)
+
+		// permuted combinations have the same ID.
+		key := fmt.Sprint(combi)
+		if prev, ok := seen[key]; ok {
+			return nil, &ConfigError{"CompositeIdxCombinations", fmt.Sprintf("%v duplicates %v", labels, prev)}
+		}
+		seen[key] = labels
+
+		combis = append(combis, combi)
+	}
+
+	return combis, nil
+}
+
+// presentCombinations returns combinations whose labels all have tokens in m.
+func (conf *Config) presentCombinations(m indexesMap) ([][]int, error) {
+	combis, err := conf.combinationPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	present := combis[:0]
+	for _, combi := range combis {
+		ok := true
+		for _, pos := range combi {
+			ok = ok && len(m[conf.CompositeIdxLabels[pos]]) > 0
+		}
+		if ok {
+			present = append(present, combi)
+		}
+	}
+
+	return present, nil
+}
+
+// compositePositions returns positions of composite labels which have tokens in m.
+func (conf *Config) compositePositions(m indexesMap) []int {
+	positions := make([]int, 0, len(conf.CompositeIdxLabels))
+	for i, label := range conf.CompositeIdxLabels {
+		if len(m[label]) > 0 {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
 // createCompositeIndexes creates composite indexes of labels from m.
 // It reduces zig-zag merge join latency.
+// It creates indexes for every combination of 2 to conf.compositeMaxSize() labels which have tokens.
 // m is indexesMap.
-// forFilters is used for Filters.
-func createCompositeIndexes(labels []string, m indexesMap, forFilters bool) ([]string, error) {
-
-	if len(labels) > MaxCompositeIndexLabels {
-		return nil, errors.Errorf("CompositeIdxLabels size exceeds %d", MaxCompositeIndexLabels)
+func createCompositeIndexes(conf *Config, m indexesMap) ([]string, error) {
+	if err := conf.validateCompositeIdxLabels(); err != nil {
+		return nil, err
 	}
 
 	indexes := make([]string, 0, 64)
 
-	f := func(combi uint8, index string, someNew bool) {
-		if forFilters && !someNew {
+	if len(conf.CompositeIdxCombinations) > 0 {
+		combis, err := conf.presentCombinations(m)
+		if err != nil {
+			return nil, err
+		}
+		for _, combi := range combis {
+			indexes = appendCombinationIndexes(indexes, conf, combi, m, false)
+		}
+		return indexes, nil
+	}
+
+	positions := conf.compositePositions(m)
+	maxSize := conf.compositeMaxSize()
+
+	var visit func(start int, combi []int)
+	visit = func(start int, combi []int) {
+		if len(combi) >= 2 {
+			indexes = appendCombinationIndexes(indexes, conf, combi, m, false)
+		}
+		if len(combi) == maxSize {
 			return
 		}
-		indexes = append(indexes, fmt.Sprintf("%d %s", combi, index))
+		for i := start; i < len(positions); i++ {
+			visit(i+1, append(combi, positions[i]))
+		}
 	}
+	visit(0, make([]int, 0, maxSize))
+
+	return indexes, nil
+}
 
-	// used indexes sets for filters
-	usedIndexes := make(indexesMap)
+// createCompositeFilters creates composite filters of labels from m.
+// Labels which have tokens are combined into chunks of conf.compositeMaxSize() labels in order.
+// covered is labels filtered with the composite filters.
+func createCompositeFilters(conf *Config, m indexesMap) (filters []string, covered []string, err error) {
+	if err := conf.validateCompositeIdxLabels(); err != nil {
+		return nil, nil, err
+	}
 
-	// generate combination indexes with bit oparation
-	// mapping each labels to each bits.
+	if len(conf.CompositeIdxCombinations) > 0 {
+		return createExplicitCompositeFilters(conf, m)
+	}
 
-	// construct recursive funcs at first.
-	// reverse loop for labels so that the first label will be right-end bit.
-	var combiForFilter uint8
-	for i := len(labels) - 1; i >= 0; i-- {
-		i := i
-		prevF := f
-		idxLabel := labels[i]
+	positions := conf.compositePositions(m)
+	maxSize := conf.compositeMaxSize()
 
-		if len(m[idxLabel]) > 0 {
-			combiForFilter |= 1 << uint(i)
+	for len(positions) >= 2 {
+		n := maxSize
+		if n > len(positions) {
+			n = len(positions)
 		}
 
-		f = func(combi uint8, index string, someNew bool) {
-			// check process bit for the combi.
-			if combi&(1<<uint(i)) != 0 {
-				tokens := make([]string, 0, len(m[idxLabel]))
-				for token := range m[idxLabel] {
-					tokens = append(tokens, token)
-				}
-				for _, token := range tokens {
-					combiIndex := appendCombinationIndex(index, token)
+		combi := positions[:n]
+		positions = positions[n:]
 
-					// check if the token is already used for filters
-					if _, ok := usedIndexes[idxLabel]; !ok {
-						usedIndexes[idxLabel] = make(map[string]struct{})
-					}
-					if _, ok := usedIndexes[idxLabel][token]; !ok {
-						usedIndexes[idxLabel][token] = struct{}{}
-						someNew = true
-					}
+		filters = appendCombinationIndexes(filters, conf, combi, m, true)
+		for _, pos := range combi {
+			covered = append(covered, conf.CompositeIdxLabels[pos])
+		}
+	}
 
-					prevF(combi, combiIndex, someNew) // recursive call
-				}
-			} else {
-				// no process bit for the combi.
-				prevF(combi, index, someNew)
-			}
+	return filters, covered, nil
+}
+
+// createExplicitCompositeFilters creates composite filters with CompositeIdxCombinations.
+// It chooses the combination with the most labels at first, and then the next one disjoint from chosen ones.
+func createExplicitCompositeFilters(conf *Config, m indexesMap) (filters []string, covered []string, err error) {
+	combis, err := conf.presentCombinations(m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// stable sort keeps the declaration order for combinations of the same size.
+	sort.SliceStable(combis, func(i, j int) bool {
+		return len(combis[i]) > len(combis[j])
+	})
+
+	chosen := make(map[int]bool)
+	for _, combi := range combis {
+		disjoint := true
+		for _, pos := range combi {
+			disjoint = disjoint && !chosen[pos]
+		}
+		if !disjoint {
+			continue
+		}
+
+		filters = appendCombinationIndexes(filters, conf, combi, m, true)
+		for _, pos := range combi {
+			chosen[pos] = true
+			covered = append(covered, conf.CompositeIdxLabels[pos])
 		}
 	}
 
-	// now generate indexes.
-	if forFilters {
-		f(combiForFilter, "", false)
-	} else {
-		for i := 3; i < (1 << uint(len(labels))); i++ {
-			if (i & (i - 1)) == 0 {
-				// do not save single index
-				continue
+	return filters, covered, nil
+}
+
+// appendCombinationIndexes appends composite indexes of labels at positions combi.
+// The combination ID is the bit set of the positions and the first label is the right-end bit.
+// forFilters is used for Filters, which needs only combinations to cover all the tokens.
+func appendCombinationIndexes(indexes []string, conf *Config, combi []int, m indexesMap, forFilters bool) []string {
+	labels := conf.CompositeIdxLabels
+
+	var id uint64
+	tokens := make([][]string, len(combi))
+	used := make([]map[string]bool, len(combi))
+	for i, pos := range combi {
+		id |= 1 << uint(pos)
+		tokens[i] = sortedTokens(m[labels[pos]])
+		used[i] = make(map[string]bool)
+	}
+
+	current := make([]string, len(combi))
+
+	var visit func(i int)
+	visit = func(i int) {
+		if i == len(combi) {
+			if forFilters {
+				someNew := false
+				for j, t := range current {
+					if !used[j][t] {
+						someNew = true
+						used[j][t] = true
+					}
+				}
+				if !someNew {
+					return
+				}
+			}
+			escaped := make([]string, len(current))
+			for j, t := range current {
+				escaped[j] = conf.escapeToken(t)
 			}
-			f(uint8(i), "", false)
+			indexes = append(indexes, fmt.Sprintf("%d %s", id, strings.Join(escaped, combiIndexSeperator)))
+			return
+		}
+		for _, t := range tokens[i] {
+			current[i] = t
+			visit(i + 1)
 		}
 	}
+	visit(0)
 
-	return indexes, nil
+	return indexes
 }
 
-func appendCombinationIndex(indexes, index string) string {
-	buf := bytes.NewBufferString(indexes)
-	if buf.Len() > 0 {
-		buf.WriteString(combiIndexSeperator)
+func sortedTokens(set map[string]struct{}) []string {
+	tokens := make([]string, 0, len(set))
+	for t := range set {
+		tokens = append(tokens, t)
 	}
-	buf.WriteString(index)
-	return buf.String()
+	sort.Strings(tokens)
+	return tokens
 }
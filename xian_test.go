@@ -1,6 +1,7 @@
 package xian
 
 import (
+	"fmt"
 	"sort"
 	"testing"
 )
@@ -8,7 +9,7 @@ import (
 func TestValidateConfig(t *testing.T) {
 	labels := make([]string, MaxCompositeIndexLabels+1)
 	for i := 0; i < len(labels); i++ {
-		labels[i] = string('a' + i)
+		labels[i] = string(rune('a' + i))
 	}
 
 	t.Run("len(CompositeIdxLabels)<=MaxCompositeIndexLabels", func(t *testing.T) {
@@ -38,7 +39,7 @@ func TestValidateConfig(t *testing.T) {
 func TestMustValidateConfig(t *testing.T) {
 	labels := make([]string, MaxCompositeIndexLabels+1)
 	for i := 0; i < len(labels); i++ {
-		labels[i] = string('a' + i)
+		labels[i] = string(rune('a' + i))
 	}
 
 	t.Run("CompositeIdxLabels<=MaxCompositeIndexLabels", func(t *testing.T) {
@@ -212,3 +213,48 @@ func containsString(list []string, target string) bool {
 	}
 	return false
 }
+
+func TestValidateConfigCompositeIdxMaxSize(t *testing.T) {
+	labels := make([]string, MaxSizedCompositeIndexLabels+1)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("l%d", i)
+	}
+
+	for _, tc := range []struct {
+		labels  int
+		maxSize int
+		valid   bool
+	}{
+		{MaxCompositeIndexLabels + 1, 3, true},
+		{MaxSizedCompositeIndexLabels, 3, true},
+		{MaxSizedCompositeIndexLabels + 1, 3, false},
+		{2, 1, false},
+		{2, -1, false},
+	} {
+		conf := &Config{CompositeIdxLabels: labels[:tc.labels], CompositeIdxMaxSize: tc.maxSize}
+		if _, err := ValidateConfig(conf); (err == nil) != tc.valid {
+			t.Errorf("labels=%d, maxSize=%d: unexpected error = %v", tc.labels, tc.maxSize, err)
+		}
+	}
+}
+
+func TestValidateConfigCompositeIdxCombinations(t *testing.T) {
+	labels := []string{"a", "b", "c"}
+
+	for _, tc := range []struct {
+		name  string
+		conf  *Config
+		valid bool
+	}{
+		{"valid", &Config{CompositeIdxLabels: labels, CompositeIdxCombinations: [][]string{{"a", "b"}, {"c", "a", "b"}}}, true},
+		{"unknown label", &Config{CompositeIdxLabels: labels, CompositeIdxCombinations: [][]string{{"a", "d"}}}, false},
+		{"single label", &Config{CompositeIdxLabels: labels, CompositeIdxCombinations: [][]string{{"a"}}}, false},
+		{"duplicated label", &Config{CompositeIdxLabels: labels, CompositeIdxCombinations: [][]string{{"a", "a"}}}, false},
+		{"duplicated combination", &Config{CompositeIdxLabels: labels, CompositeIdxCombinations: [][]string{{"a", "b"}, {"b", "a"}}}, false},
+		{"with CompositeIdxMaxSize", &Config{CompositeIdxLabels: labels, CompositeIdxMaxSize: 2, CompositeIdxCombinations: [][]string{{"a", "b"}}}, false},
+	} {
+		if _, err := ValidateConfig(tc.conf); (err == nil) != tc.valid {
+			t.Errorf("%s: unexpected error = %v", tc.name, err)
+		}
+	}
+}